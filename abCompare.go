@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// abStates contains the two states the abCompare action switches between, e.g. mix and reference track
+var abStates [2]*stateSnapshot
+
+// readABCompare reads the A and B states from the config key 'abCompare'
+func readABCompare() ([2]*stateSnapshot, error) {
+	var cfg struct {
+		A snapshotConfig `mapstructure:"a"`
+		B snapshotConfig `mapstructure:"b"`
+	}
+	if err := viper.UnmarshalKey("abCompare", &cfg); err != nil {
+		return [2]*stateSnapshot{}, err
+	}
+	return [2]*stateSnapshot{newStateSnapshot(cfg.A), newStateSnapshot(cfg.B)}, nil
+}
+
+// abCompareButton returns the button definition used for a button mapped to the abCompare action. The button is 'on'
+// while state B is active
+func abCompareButton() button {
+	return button{
+		state:      false,
+		latch:      false,
+		LCDchannel: 8,
+		LCDrow:     lowerRow,
+		action:     actionABCompare,
+	}
+}
+
+// abLCDtext returns the display text for state A (0) or B (1)
+func abLCDtext(state int) string {
+	name := "AB"[state : state+1]
+	if abStates[state] != nil && abStates[state].name != "" {
+		name = abStates[state].name
+	}
+	return fmt.Sprintf("%-7.7s", " -"+strings.ToUpper(name)+"-")
+}
+
+// doABCompare flips between state A and B and shows the name of the new state
+func doABCompare(midiController midiController, buttonNumber int) {
+	activeProfile.buttons[buttonNumber].state = !activeProfile.buttons[buttonNumber].state
+	state := 0
+	if activeProfile.buttons[buttonNumber].state {
+		state = 1
+	}
+	showIndicators()
+	if abStates[state] == nil {
+		return
+	}
+	slog.Info("A/B compare", "state", abStates[state].name)
+	applySnapshot(midiController, abStates[state])
+	if viper.GetBool("useDisplay") {
+		showCell(activeProfile.buttons[buttonNumber].LCDchannel, activeProfile.buttons[buttonNumber].LCDrow, abLCDtext(state))
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awitez/shuttleMidi/devices"
+
+	"github.com/bearsh/hid"
+	"github.com/spf13/viper"
+	"gitlab.com/gomidi/midi/writer"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `usage: shuttleMidi [--config file] [command]
+
+options:
+  --config file            config file, default: $SHUTTLEMIDI_CONFIG or shuttleMidi.yaml in $XDG_CONFIG_HOME
+                           (default: ~/.config). shuttleMidi.<hostname>.yaml and shuttleMidi.local.yaml next
+                           to it are merged on top of it
+
+commands:
+  run                      start the tray application (default)
+  list-midi                list the MIDI output ports
+  list-hid                 list the HID devices, a ShuttlePRO v2 is marked with *
+  config validate [file]   check a config file and its override files (default: the file used by ShuttleMidi)
+  config dump-defaults     print the default settings as YAML
+  monitor                  print the events of the ShuttlePRO v2 until interrupted
+  send-cc [-device name] [-channel n] cc value
+                           send a single MIDI CC, by default to the control MIDI device
+  snapshot recall name     let the running tray application recall a snapshot, needs 'oscListen'
+`
+
+// parseFlags parses the options preceding the command and returns the command line without them. macOS passes
+// -psn_... to apps started by the Finder on older versions, it is ignored
+func parseFlags(args []string) ([]string, error) {
+	filtered := make([]string, 0, len(args))
+	for _, v := range args {
+		if !strings.HasPrefix(v, "-psn_") {
+			filtered = append(filtered, v)
+		}
+	}
+	flags := flag.NewFlagSet(configName, flag.ContinueOnError)
+	flags.StringVar(&configPath, "config", "", "config file")
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	if err := flags.Parse(filtered); err != nil {
+		return nil, err
+	}
+	return flags.Args(), nil
+}
+
+// isRunCommand reports if the command line starts the tray application
+func isRunCommand(args []string) bool {
+	return len(args) == 0 || args[0] == "run"
+}
+
+// runCommand executes the command line subcommands except 'run' and returns the exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "list-midi":
+		return listMIDICommand()
+	case "list-hid":
+		return listHIDCommand()
+	case "config":
+		if len(args) > 1 && args[1] == "validate" {
+			return validateCommand(args[2:])
+		}
+		if len(args) > 1 && args[1] == "dump-defaults" {
+			return dumpDefaultsCommand()
+		}
+	case "monitor":
+		return monitorCommand()
+	case "send-cc":
+		return sendCCCommand(args[1:])
+	case "snapshot":
+		if len(args) == 3 && args[1] == "recall" {
+			return recallSnapshotCommand(args[2])
+		}
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return 0
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+// listMIDICommand prints the MIDI output ports with their index
+func listMIDICommand() int {
+	MIDIdevices, err := getMIDIDevices(nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for i, v := range MIDIdevices {
+		fmt.Printf("%d: %s\n", i, v)
+	}
+	return 0
+}
+
+// listHIDCommand prints all HID devices, a ShuttlePRO v2 is marked with *
+func listHIDCommand() int {
+	for _, v := range hid.Enumerate(0, 0) {
+		marker := " "
+		if devices.IsShuttleProV2(v) {
+			marker = "*"
+		}
+		fmt.Printf("%s %04x:%04x %s %s (%s)\n", marker, v.VendorID, v.ProductID, v.Manufacturer, v.Product, v.Path)
+	}
+	return 0
+}
+
+// dumpDefaultsCommand prints the default settings in the format of the config file
+func dumpDefaultsCommand() int {
+	out, err := yaml.Marshal(configDefaults)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(string(out))
+	return 0
+}
+
+// monitorCommand opens the ShuttlePRO v2 and prints its wheel, dial and button events without sending MIDI messages
+func monitorCommand() int {
+	shuttlePro, err := devices.NewShuttleProV2()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	interruptCh := make(chan os.Signal, 1)
+	signal.Notify(interruptCh, os.Interrupt)
+
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	shuttlePro.WheelPosition = make(chan int8)
+	shuttlePro.DialDirection = make(chan int8)
+	buttonCh := shuttleButtons(quitCh, shuttlePro)
+
+	fmt.Println("monitoring ShuttlePRO v2, press Ctrl-C to stop")
+	for {
+		select {
+		case <-interruptCh:
+			return 0
+		case wp := <-shuttlePro.WheelPosition:
+			fmt.Printf("wheel  %d\n", wp)
+		case dd := <-shuttlePro.DialDirection:
+			fmt.Printf("dial   %+d\n", dd)
+		case ev := <-buttonCh:
+			state := "released"
+			if ev.pressed {
+				state = "pressed"
+			}
+			fmt.Printf("button %d %s\n", ev.number, state)
+		}
+	}
+}
+
+// controlTarget returns the control MIDI device and channel of the active profile of the settings, like
+// profileMidiDevice. The first profile is used if none has the name of 'activeProfile'
+func controlTarget(settings *viper.Viper) (string, uint8, error) {
+	var cfg []profileConfig
+	if err := settings.UnmarshalKey("profiles", &cfg); err != nil {
+		return "", 0, err
+	}
+	device, channel := "", builtinProfile().channel
+	for i, v := range cfg {
+		if i == 0 || v.Name == settings.GetString("activeProfile") {
+			device, channel = v.MidiDevice, v.Channel
+		}
+	}
+	if device == "" {
+		device = settings.GetString("controlMidiDevice")
+	}
+	return device, channel, nil
+}
+
+// sendCCCommand sends a single MIDI CC. Device and channel default to the control MIDI device and channel of the
+// active profile
+func sendCCCommand(args []string) int {
+	flags := flag.NewFlagSet("send-cc", flag.ContinueOnError)
+	device := flags.String("device", "", "MIDI output port, default: the control MIDI device")
+	channel := flags.Int("channel", -1, "MIDI channel (0-15), default: the channel of the active profile")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	cc, errCC := strconv.ParseUint(flags.Arg(0), 10, 7)
+	value, errValue := strconv.ParseUint(flags.Arg(1), 10, 7)
+	if errCC != nil || errValue != nil {
+		fmt.Fprintln(os.Stderr, "cc and value must be numbers in the range 0-127")
+		return 2
+	}
+
+	if *device == "" || *channel < 0 {
+		settings, err := readSettings()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		profileDevice, profileChannel, err := controlTarget(settings)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if *device == "" {
+			*device = profileDevice
+		}
+		if *channel < 0 {
+			*channel = int(profileChannel)
+		}
+	}
+	if *channel > 15 {
+		fmt.Fprintln(os.Stderr, "channel must be in the range 0-15")
+		return 2
+	}
+
+	mc := &midiControl{deviceName: *device, delay: messageRepeatDelay * time.Millisecond, channel: uint8(*channel)}
+	if err := mc.open(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *device, err)
+		return 1
+	}
+	defer mc.close()
+	if err := writer.ControlChange(mc.writer, uint8(cc), uint8(value)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// recallSnapshotCommand sends the OSC message recalling the named snapshot to the running tray application
+func recallSnapshotCommand(name string) int {
+	settings, err := readSettings()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	target := settings.GetString("oscListen")
+	if target == "" {
+		fmt.Fprintln(os.Stderr, "oscListen isn't set, ShuttleMidi doesn't receive OSC messages")
+		return 1
+	}
+	if err := sendOSCTo(target, oscRecallAddress, name); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestControlTarget(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		wantDevice  string
+		wantChannel uint8
+	}{
+		{"defaults", "", "IAC monitorControl", 0},
+		{"control device", "controlMidiDevice: X-Touch\n", "X-Touch", 0},
+		{"active profile", `
+controlMidiDevice: X-Touch
+activeProfile: Reaper
+profiles:
+  - name: Monitor
+    channel: 1
+  - name: Reaper
+    channel: 3
+    midiDevice: "regex:^Reaper"
+`, "regex:^Reaper", 3},
+		{"unknown active profile", `
+activeProfile: Missing
+profiles:
+  - name: Monitor
+    channel: 2
+  - name: Reaper
+    channel: 3
+`, "IAC monitorControl", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, err := newSettings([]configSource{{file: "config.yaml", data: []byte(tt.config)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			device, channel, err := controlTarget(settings)
+			if err != nil || device != tt.wantDevice || channel != tt.wantChannel {
+				t.Errorf("controlTarget() = %q, %d, %v, want %q, %d", device, channel, err, tt.wantDevice,
+					tt.wantChannel)
+			}
+		})
+	}
+}
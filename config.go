@@ -1,10 +1,18 @@
 package main
 
+import "github.com/awitez/shuttleMidi/devices"
+
 const (
 	applicationName = "ShuttleMidi"
+	// name of the config file, without extension
+	configName = "shuttleMidi"
+	// environment variable selecting the config file, like the --config flag
+	configPathEnv = "SHUTTLEMIDI_CONFIG"
+	// version of the config file format, older files are migrated by migrateConfigFiles
+	currentConfigVersion = 2
 	// midi CC number for main volume
 	mainVolumeCC = 7
-	// midi CC number for headPhone volume
+	// midi CC number for headPhone volume (default of the first cue)
 	headPhoneVolumeCC = 102
 
 	// button number from ShuttlePro device
@@ -13,6 +21,7 @@ const (
 	LsRsButton           = 2
 	headPhoneButton      = 3
 	stereoSurroundButton = 8
+	dimButton            = 13
 
 	CCvalueOn  = 127
 	CCvalueOff = 0
@@ -21,13 +30,32 @@ const (
 	on     = 1
 	toggle = 2
 
+	// special actions a profile button can be mapped to, see actionNames
+	actionNone         = 0
+	actionTalkback     = 1
+	actionSelectCue    = 2
+	actionABCompare    = 3
+	actionSnapshot     = 4
+	actionCycleProfile = 5
+	actionNextPage     = 6
+
 	upperRow = 0
 	lowerRow = 56 // offset for lower LCD row
 
 	// delay in milliseconds for repeating midi commands
 	messageRepeatDelay = 300
-	// delay in milliseconds between sending upper & lower row of text to MCU device
-	displayRowsDelay = 400
+	// time in milliseconds to wait for the event loop to accept a request, e.g. a snapshot recall
+	requestTimeout = 1000
+	// LCD channel (lower row) showing the name of the active profile after switching
+	profileLCDchannel = 8
+	// interval in milliseconds for checking if the MIDI ports are still available
+	portPollInterval = 2000
+	// interval in milliseconds for sending the channel meters again before they fall back
+	meterRefreshInterval = 250
+	// time in milliseconds to wait for pending display updates before quitting or switching the display
+	displayDrainTimeout = 2000
+	// interval in milliseconds for checking the focused window
+	focusPollInterval = 500
 
 	// colors for X-Touch LCD
 	black   = "00"
@@ -38,6 +66,11 @@ const (
 	magenta = "05"
 	cyan    = "06"
 	white   = "07"
+
+	// values of the button setting 'blink'
+	blinkText  = "text"
+	blinkColor = "color"
+	blinkBoth  = "both"
 )
 
 var (
@@ -79,16 +112,89 @@ var (
 	mainVolume float32 = 40
 	// amount of main volume change per dial step
 	mainVolumeDelta float32 = 1.3
-	// start value for headPhone volume
-	headPhoneVolume float32 = 60
-	// amount of headphone volume change per dial step
+	// amount of headphone/cue volume change per dial step
 	headPhoneVolumeDelta float32 = 1.4
 	// configDefaults contains the default configuration written to the configuration file
 	configDefaults = map[string]interface{}{
-		"controlMidiDevice": "IAC monitorControl",
-		"displayMidiDevice": "X-Touch INT",
-		"useDisplay":        true,
-		"useMediaKeys":      true,
+		"configVersion":      currentConfigVersion,
+		"controlMidiDevice":  "IAC monitorControl",
+		"displayMidiDevice":  "X-Touch INT",
+		"useDisplay":         true,
+		"displayType":        "xtouch",   // "xtouch", "mcu", "mcuCompatible" (e.g. iCON), "tui" (terminal) or "none"
+		"displaySysexHeader": "",         // sysex header of an mcuCompatible display as hex bytes, "" = MCU header
+		"tuiOutput":          "",         // terminal (e.g. /dev/ttys003) emulating the display, "" = none (tui: stdout)
+		"displayQueueSize":   256,        // maximum number of pending LED, ring and segment updates of the display
+		"displayRate":        200,        // maximum number of messages per second sent to the display, 0 = unlimited
+		"displayPages":       pageNames,  // display pages in the order the nextPage action flips through them
+		"stripColor":         "yellow",   // color of the strips used by the active profile, see colorNames
+		"blinkRate":          400,        // blink interval in milliseconds of cells and strips, 0 = no blinking
+		"mainRing":           "fill",     // V-Pot ring mode of the main volume ("dot", "fill", "spread"), "" = no ring
+		"volumeMeters":       false,      // show the main and cue volumes on the channel meters too, resent 4x a second
+		"timecodeDisplay":    "volume",   // shown on the 7-segment timecode display: "volume", "profile" or "" (unused)
+		"assignmentDisplay":  "speakers", // shown on the 7-segment assignment display: "speakers", "profile" or ""
+		"useMediaKeys":       true,
+		"useInternalDim":     false, // dim the main volume by ShuttleMidi instead of sending the dim CC to the DAW
+		"dimLevel":           20.0,  // amount of attenuation in dB while dim is active
+		"talkbackCC":         85,    // midi CC (or note) number sent while talkback is active
+		"talkbackNote":       false, // send a note instead of a CC for talkback
+		"talkbackLatch":      false, // talkback button toggles instead of being active only while held
+		"talkbackDimLevel":   20.0,  // amount of attenuation of the main volume in dB while talkback is active
+		"talkbackCueLevel":   -1,    // cue volume (0-127) while talkback is active, -1 leaves the cues untouched
+		"cues": []map[string]interface{}{ // headphone/cue outputs, the first one is used by the headphone button
+			{"name": "Phones", "cc": headPhoneVolumeCC, "volume": 60, "lcdChannel": 7, "ring": "fill"},
+		},
+		"oscTarget": "127.0.0.1:9000", // host:port receiving OSC messages for cues with an 'osc' address
+		"oscListen": "",               // host:port receiving OSC messages, e.g. snapshot recalls, "" = off (read at start)
+		"abCompare": map[string]interface{}{ // the two states switched by the abCompare action
+			"a": map[string]interface{}{"name": "MIX", "buttons": map[string]bool{}, "ccs": map[string]int{}, "volumeOffset": 0.0},
+			"b": map[string]interface{}{"name": "REF", "buttons": map[string]bool{}, "ccs": map[string]int{}, "volumeOffset": 0.0},
+		},
+		"snapshots":     []map[string]interface{}{},                          // named snapshots of the complete monitor state
+		"profiles":      []map[string]interface{}{builtinProfile().config()}, // mapping profiles
+		"activeProfile": "Monitor",
+		"profileChord":  []int{},               // button numbers (0-14) which cycle the profiles when pressed together
+		"autoProfile":   false,                 // switch profiles depending on the focused window
+		"focusBackend":  "auto",                // "auto", "x11" or "macos"
+		"focusRules":    []map[string]string{}, // e.g. {"match": "reaper", "profile": "Reaper"}, first match wins
+	}
+
+	// actionNames maps the action names used in the config file to the button actions
+	actionNames = map[string]int{
+		"talkback":     actionTalkback,
+		"selectCue":    actionSelectCue,
+		"abCompare":    actionABCompare,
+		"snapshot":     actionSnapshot, // "snapshot:<name>" recalls the named snapshot
+		"cycleProfile": actionCycleProfile,
+		"nextPage":     actionNextPage,
+	}
+
+	// blinkModes are the values of the button setting 'blink'
+	blinkModes = []string{blinkText, blinkColor, blinkBoth}
+
+	// ledModes maps the LED modes used in the config file to the MCU button LED modes
+	ledModes = map[string]devices.LEDMode{
+		"off":   devices.LEDOff,
+		"on":    devices.LEDOn,
+		"blink": devices.LEDBlink,
+	}
+
+	// ringModes maps the ring modes used in the config file to the MCU V-Pot ring modes
+	ringModes = map[string]devices.RingMode{
+		"dot":    devices.RingDot,
+		"fill":   devices.RingFill,
+		"spread": devices.RingSpread,
+	}
+
+	// colorNames maps the color names used in the config file to the X-Touch LCD colors
+	colorNames = map[string]string{
+		"black":   black,
+		"red":     red,
+		"green":   green,
+		"yellow":  yellow,
+		"blue":    blue,
+		"magenta": magenta,
+		"cyan":    cyan,
+		"white":   white,
 	}
 )
 
@@ -100,9 +206,20 @@ type button struct {
 	msgOff     string // GUI message for 'off'
 	LCDchannel uint8  // channel to display text on MCU
 	LCDrow     uint8  // upper or lower row on LCD
+	note       bool   // send a midi note instead of a CC
+	action     int    // special action executed instead of the default button handling
+	arg        string // argument of the action, e.g. the snapshot name
+	colorOn    string // color name of the LCD strip while the button is 'on', "" = unchanged
+	colorOff   string // color name of the LCD strip while the button is 'off', "" = unchanged
+	blink      string // blink the text cell (blinkText), the strip color (blinkColor) or both while the button is 'on'
+	hasLED     bool   // the button has an LED on the control surface
+	led        uint8  // MCU note number of the LED
+	ledOn      string // LED mode while the button is 'on', "" = "on"
+	ledOff     string // LED mode while the button is 'off', "" = "off"
 }
 
-var csPro [15]button = [15]button{
+// defaultButtons is the button mapping of the built-in monitor profile
+var defaultButtons [15]button = [15]button{
 
 	{ // 00 LR
 		state:      true,
@@ -112,6 +229,11 @@ var csPro [15]button = [15]button{
 		msgOff:     " LR off",
 		LCDchannel: 5,
 		LCDrow:     upperRow,
+		colorOff:   "red",
+		hasLED:     true,
+		led:        20, // mute button of channel 5
+		ledOn:      "off",
+		ledOff:     "on",
 	},
 	{ // 01 LFE
 		state:      true,
@@ -139,6 +261,9 @@ var csPro [15]button = [15]button{
 		msgOff:     "Phn off",
 		LCDchannel: 7,
 		LCDrow:     upperRow,
+		colorOn:    "cyan",
+		hasLED:     true,
+		led:        30, // select button of channel 7
 	},
 	{ // 04 Previous
 		state:      true,
@@ -189,6 +314,11 @@ var csPro [15]button = [15]button{
 		msgOff:     "       ",
 		LCDchannel: 8,
 		LCDrow:     lowerRow,
+		colorOn:    "magenta",
+		blink:      blinkText,
+		hasLED:     true,
+		led:        15, // solo button of channel 8
+		ledOn:      "blink",
 	},
 	{ // 10 Right solo
 		state:      false,
@@ -198,6 +328,11 @@ var csPro [15]button = [15]button{
 		msgOff:     "       ",
 		LCDchannel: 8,
 		LCDrow:     lowerRow,
+		colorOn:    "magenta",
+		blink:      blinkText,
+		hasLED:     true,
+		led:        15, // solo button of channel 8
+		ledOn:      "blink",
 	},
 	{ // 11 Mid solo
 		state:      false,
@@ -207,6 +342,11 @@ var csPro [15]button = [15]button{
 		msgOff:     "       ",
 		LCDchannel: 8,
 		LCDrow:     lowerRow,
+		colorOn:    "magenta",
+		blink:      blinkText,
+		hasLED:     true,
+		led:        15, // solo button of channel 8
+		ledOn:      "blink",
 	},
 	{ // 12 Side solo
 		state:      false,
@@ -216,6 +356,11 @@ var csPro [15]button = [15]button{
 		msgOff:     "       ",
 		LCDchannel: 8,
 		LCDrow:     lowerRow,
+		colorOn:    "magenta",
+		blink:      blinkText,
+		hasLED:     true,
+		led:        15, // solo button of channel 8
+		ledOn:      "blink",
 	},
 	{ // 13 Dim
 		state:      false,
@@ -225,6 +370,10 @@ var csPro [15]button = [15]button{
 		msgOff:     "       ",
 		LCDchannel: 8,
 		LCDrow:     lowerRow,
+		blink:      blinkText,
+		hasLED:     true,
+		led:        23, // mute button of channel 8
+		ledOn:      "blink",
 	},
 	{ // 14 Mono
 		state:      false,
@@ -234,5 +383,6 @@ var csPro [15]button = [15]button{
 		msgOff:     "       ",
 		LCDchannel: 8,
 		LCDrow:     lowerRow,
+		blink:      blinkText,
 	},
 }
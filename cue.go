@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/viper"
+)
+
+// cue is a headphone/cue mix output with its own volume
+type cue struct {
+	name       string  // name shown on the display when the cue is selected
+	cc         uint8   // midi CC number for the cue volume
+	osc        string  // OSC address for the cue volume, used instead of the CC if set
+	volume     float32 // current volume (0-127)
+	LCDchannel uint8   // channel to display the volume on MCU (lower row), 0 = not displayed
+	ring       string  // mode of the V-Pot ring of LCDchannel showing the volume, "" = no ring
+}
+
+// cueConfig is the representation of a cue in the config file
+type cueConfig struct {
+	Name       string  `mapstructure:"name"`
+	CC         uint8   `mapstructure:"cc"`
+	OSC        string  `mapstructure:"osc"`
+	Volume     float32 `mapstructure:"volume"`
+	LCDchannel uint8   `mapstructure:"lcdChannel"`
+	Ring       string  `mapstructure:"ring"` // "dot", "fill" or "spread"
+}
+
+var (
+	// cues contains all cue outputs. The first one is the engineer's headphone output
+	cues []cue
+	// index of the cue controlled by the dial, -1 = default (headphones if headphone button is on, else main volume)
+	selectedCue = -1
+)
+
+// readCues reads the cue outputs from the config key 'cues'
+func readCues() ([]cue, error) {
+	var cfg []cueConfig
+	if err := viper.UnmarshalKey("cues", &cfg); err != nil {
+		return nil, err
+	}
+	result := make([]cue, 0, len(cfg))
+	for _, v := range cfg {
+		result = append(result, cue{name: v.Name, cc: v.CC, osc: v.OSC, volume: min(v.Volume, 127), LCDchannel: v.LCDchannel,
+			ring: v.Ring})
+	}
+	return result, nil
+}
+
+// dialCue returns the index of the cue controlled by the dial or -1 if the dial controls the main volume
+func dialCue() int {
+	if selectedCue >= 0 && selectedCue < len(cues) {
+		return selectedCue
+	}
+	if activeProfile.monitor && activeProfile.buttons[headPhoneButton].state && len(cues) > 0 {
+		return 0
+	}
+	return -1
+}
+
+// sendCueValue transmits a volume value for the cue via MIDI CC or OSC without changing the cue's volume. Cue CCs are
+// only sent by monitor profiles
+func sendCueValue(midiController midiController, cueNumber int, value uint8) {
+	if cues[cueNumber].osc != "" {
+		if err := sendOSC(cues[cueNumber].osc, float32(value)/127); err != nil {
+			slog.Error("osc: can't send cue volume", "cue", cues[cueNumber].name, "err", err)
+		}
+		return
+	}
+	if !activeProfile.monitor {
+		return
+	}
+	midiController.sendCommand(cues[cueNumber].cc, value, false)
+}
+
+// sendCueVolume transmits the volume of the cue and shows it on the display
+func sendCueVolume(midiController midiController, cueNumber int) {
+	if viper.GetBool("useDisplay") && cues[cueNumber].LCDchannel != 0 {
+		showCell(cues[cueNumber].LCDchannel, lowerRow, headPhoneVolTable[uint8(cues[cueNumber].volume)])
+		showVolumeRing(cues[cueNumber].LCDchannel, cues[cueNumber].ring, uint8(cues[cueNumber].volume))
+	}
+	sendCueValue(midiController, cueNumber, uint8(cues[cueNumber].volume))
+}
+
+// selectCueButton returns the button definition used for a button mapped to the selectCue action
+func selectCueButton() button {
+	return button{
+		cc:         0,
+		latch:      false,
+		LCDchannel: 8,
+		LCDrow:     lowerRow,
+		action:     actionSelectCue,
+	}
+}
+
+// selectNextCue selects the next cue to be controlled by the dial. After the last cue the default is selected again
+func selectNextCue(buttonNumber int) {
+	selectedCue++
+	if selectedCue >= len(cues) {
+		selectedCue = -1
+	}
+
+	name := "Default"
+	if selectedCue >= 0 {
+		name = cues[selectedCue].name
+	}
+	slog.Info("cue selected", "cue", name)
+	if viper.GetBool("useDisplay") && activeProfile.buttons[buttonNumber].LCDchannel != 0 {
+		showCell(activeProfile.buttons[buttonNumber].LCDchannel, activeProfile.buttons[buttonNumber].LCDrow, fmt.Sprintf("%-7.7s", name))
+	}
+}
@@ -0,0 +1,86 @@
+package devices
+
+import "sync"
+
+// LEDMode is the state of an MCU button LED, sent as velocity of the button's note
+type LEDMode uint8
+
+const (
+	LEDOff   LEDMode = 0
+	LEDBlink LEDMode = 1
+	LEDOn    LEDMode = 127
+)
+
+// ButtonLEDs holds the modes of the MCU button LEDs and the modes the device currently shows. Flush sends only the
+// changed LEDs. LEDs never set aren't sent at all, so other software (e.g. the DAW) can use them
+type ButtonLEDs struct {
+	mutex   sync.Mutex
+	display Display
+	modes   map[uint8]LEDMode
+	shown   map[uint8]LEDMode // modes known to be on the device
+}
+
+// NewButtonLEDs returns button LEDs without any LED set
+func NewButtonLEDs() *ButtonLEDs {
+	return &ButtonLEDs{modes: map[uint8]LEDMode{}, shown: map[uint8]LEDMode{}}
+}
+
+// SetDisplay sets the control surface. Changing it sends all LEDs with the next Flush
+func (l *ButtonLEDs) SetDisplay(display Display) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if display != l.display {
+		l.display = display
+		l.shown = map[uint8]LEDMode{}
+	}
+}
+
+// Set sets the mode of the LED of the button with the note number
+func (l *ButtonLEDs) Set(note uint8, mode LEDMode) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.modes[note&0x7f] = mode
+}
+
+// Mode returns the mode of the LED of the button with the note number and if it was set at all
+func (l *ButtonLEDs) Mode(note uint8) (LEDMode, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	mode, ok := l.modes[note]
+	return mode, ok
+}
+
+// Clear switches all LEDs set so far off
+func (l *ButtonLEDs) Clear() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for k := range l.modes {
+		l.modes[k] = LEDOff
+	}
+}
+
+// Invalidate forgets what the device shows, the next Flush sends all LEDs
+func (l *ButtonLEDs) Invalidate() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.shown = map[uint8]LEDMode{}
+}
+
+// Flush sends the changed LEDs to the device
+func (l *ButtonLEDs) Flush() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.display == nil || !l.display.Capabilities().Controls {
+		return nil
+	}
+	for note, mode := range l.modes {
+		if shown, ok := l.shown[note]; ok && shown == mode {
+			continue
+		}
+		if err := l.display.SetLED(note, mode); err != nil {
+			return err
+		}
+		l.shown[note] = mode
+	}
+	return nil
+}
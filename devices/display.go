@@ -0,0 +1,125 @@
+package devices
+
+import (
+	"errors"
+	"fmt"
+)
+
+// display types as used by NewDisplay
+const (
+	DisplayMCU           = "mcu"           // Mackie Control Universal, no strip colors
+	DisplayXTouch        = "xtouch"        // Behringer X-Touch, with strip colors
+	DisplayMCUCompatible = "mcuCompatible" // other MCU compatible units (e.g. iCON), optionally with another sysex header
+	DisplayNone          = "none"          // no display, everything is discarded
+	DisplayTUI           = "tui"           // terminal emulation, created by NewTUIDisplay
+)
+
+var ErrUnknownDisplay = errors.New("unknown display type")
+
+// Capabilities describes what a display can show
+type Capabilities struct {
+	Text     bool // scribble strips
+	Colors   bool // colors of the scribble strips
+	Controls bool // button LEDs, V-Pot rings, meters and 7-segment displays
+}
+
+// Display is a control surface showing the state of ShuttleMidi. Displays are comparable, two displays are equal if
+// they address the same unit in the same way
+type Display interface {
+	// WriteText writes text to the scribble strips starting at the character offset (0-55 upper row, 56-111 lower row)
+	WriteText(offset int, text string) error
+	// SetColors sets the colors of the 8 strips, given as hex bytes ("00" off - "07" white). Strips without a color
+	// are switched off
+	SetColors(colors [StripCount]string) error
+	// SetLED sets the LED of the button with the note number
+	SetLED(note uint8, mode LEDMode) error
+	// SetRing sets the LEDs of the V-Pot ring of the channel (1-8) to the ring mode and position of value (see
+	// ringValue)
+	SetRing(channel uint8, value uint8) error
+	// SetMeters sets the meters of the channels (1-8) to the levels (0-12) by channel in one go. The meters fall
+	// back on their own, so they are sent periodically
+	SetMeters(levels map[uint8]uint8) error
+	// SetDigit sets a digit of the 7-segment displays (0-9 timecode, 10-11 assignment, counted from the right) to the
+	// digit value (see segmentChar)
+	SetDigit(digit uint8, value uint8) error
+	// Clear blanks all scribble strips
+	Clear() error
+	// Capabilities returns what the display can show
+	Capabilities() Capabilities
+}
+
+// NewDisplay returns the display of the type connected to the MIDI port device. header replaces the sysex header
+// (manufacturer ID and model, as hex bytes) of an mcuCompatible display, "" keeps the header of the MCU
+func NewDisplay(kind string, device string, header string) (Display, error) {
+	switch kind {
+	case DisplayMCU:
+		return mcuDisplay{device: device, header: mcuHeader}, nil
+	case DisplayXTouch:
+		return mcuDisplay{device: device, header: mcuHeader, colors: true}, nil
+	case DisplayMCUCompatible:
+		if header == "" {
+			header = mcuHeader
+		}
+		return mcuDisplay{device: device, header: header}, nil
+	case DisplayNone:
+		return NullDisplay{}, nil
+	}
+	return NullDisplay{}, fmt.Errorf("%w: %s", ErrUnknownDisplay, kind)
+}
+
+// NullDisplay discards everything, it is used without a control surface
+type NullDisplay struct{}
+
+func (NullDisplay) WriteText(offset int, text string) error   { return nil }
+func (NullDisplay) SetColors(colors [StripCount]string) error { return nil }
+func (NullDisplay) SetLED(note uint8, mode LEDMode) error     { return nil }
+func (NullDisplay) SetRing(channel uint8, value uint8) error  { return nil }
+func (NullDisplay) SetMeters(levels map[uint8]uint8) error    { return nil }
+func (NullDisplay) SetDigit(digit uint8, value uint8) error   { return nil }
+func (NullDisplay) Clear() error                              { return nil }
+func (NullDisplay) Capabilities() Capabilities                { return Capabilities{} }
+
+// mirrorDisplay shows everything on two displays, e.g. the hardware and a terminal display
+type mirrorDisplay struct {
+	primary Display
+	mirror  Display
+}
+
+// MirrorDisplay returns a display showing everything on both primary and mirror
+func MirrorDisplay(primary Display, mirror Display) Display {
+	return mirrorDisplay{primary: primary, mirror: mirror}
+}
+
+func (d mirrorDisplay) WriteText(offset int, text string) error {
+	return errors.Join(d.primary.WriteText(offset, text), d.mirror.WriteText(offset, text))
+}
+
+func (d mirrorDisplay) SetColors(colors [StripCount]string) error {
+	return errors.Join(d.primary.SetColors(colors), d.mirror.SetColors(colors))
+}
+
+func (d mirrorDisplay) SetLED(note uint8, mode LEDMode) error {
+	return errors.Join(d.primary.SetLED(note, mode), d.mirror.SetLED(note, mode))
+}
+
+func (d mirrorDisplay) SetRing(channel uint8, value uint8) error {
+	return errors.Join(d.primary.SetRing(channel, value), d.mirror.SetRing(channel, value))
+}
+
+func (d mirrorDisplay) SetMeters(levels map[uint8]uint8) error {
+	return errors.Join(d.primary.SetMeters(levels), d.mirror.SetMeters(levels))
+}
+
+func (d mirrorDisplay) SetDigit(digit uint8, value uint8) error {
+	return errors.Join(d.primary.SetDigit(digit, value), d.mirror.SetDigit(digit, value))
+}
+
+func (d mirrorDisplay) Clear() error {
+	return errors.Join(d.primary.Clear(), d.mirror.Clear())
+}
+
+// Capabilities returns what any of the two displays can show. Each display ignores what it can't show
+func (d mirrorDisplay) Capabilities() Capabilities {
+	p, m := d.primary.Capabilities(), d.mirror.Capabilities()
+	return Capabilities{Text: p.Text || m.Text, Colors: p.Colors || m.Colors, Controls: p.Controls || m.Controls}
+}
@@ -4,71 +4,99 @@ import (
 	"fmt"
 	"log/slog"
 	"os/exec"
-	"time"
+	"strings"
 )
 
 const (
-	// Behringer X-Touch sysex vendor ID
-	MCUvendorId = "00 00 66 14 "
-	cmdText     = "12 " // 'the following bytes are text'
-	cmdColor    = "72 " // 'the following bytes are colors'
+	// sysex header of the Mackie Control Universal (manufacturer ID and model), also used by the Behringer X-Touch
+	mcuHeader = "00 00 66 14"
+	cmdText   = "12 " // 'the following bytes are text'
+	cmdColor  = "72 " // 'the following bytes are colors'
 
-	displayRowsDelay = 400                          // in milliseconds
-	sendMidi         = "/opt/homebrew/bin/sendmidi" // TODO: replace sendmidi cmd with goMidi V2
+	sendMidi = "/opt/homebrew/bin/sendmidi" // TODO: replace sendmidi cmd with goMidi V2
 )
 
-func InitColor(device string, color string) {
-	hexText := "00 00 00 00 " + color + " " + color + " " + color + " " + color
+// mcuDisplay is a Mackie Control Universal or a compatible unit connected to a MIDI port
+type mcuDisplay struct {
+	device string
+	header string // sysex header as hex bytes
+	colors bool   // the unit has colored scribble strips (X-Touch)
+}
 
-	app := sendMidi + " dev '" + device + "' hex syx " + MCUvendorId + cmdColor + hexText
+// sendmidi runs 'sendmidi' with the arguments for the device
+func (d mcuDisplay) sendmidi(args string) error {
+	app := sendMidi + " dev '" + d.device + "' " + args
 	cmd := exec.Command("bash", "-c", app)
 	if err := cmd.Run(); err != nil {
-		slog.Error("can't run 'sendmidi'", err)
+		slog.Error("can't run 'sendmidi'", "err", err)
+		return err
 	}
+	return nil
+}
+
+// sendSysex sends a MCU sysex message (without header) given as hex bytes
+func (d mcuDisplay) sendSysex(hexData string) error {
+	return d.sendmidi("hex syx " + strings.TrimSpace(d.header) + " " + hexData)
 }
 
-func DisplayLCDtext(device string, channel uint8, row uint8, text string) {
+// WriteText writes text to the scribble strips starting at the character offset
+func (d mcuDisplay) WriteText(offset int, text string) error {
 	hexText := ""
 	for _, v := range text {
 		hexText = hexText + fmt.Sprintf(" %X", v)
 	}
+	return d.sendSysex(cmdText + fmt.Sprintf(" %X", offset) + hexText)
+}
 
-	start := row + ((channel - 1) * 7)
-	app := sendMidi + " dev '" + device + "' hex syx " + MCUvendorId + cmdText + fmt.Sprintf(" %X", start) + hexText
-	cmd := exec.Command("bash", "-c", app)
-	if err := cmd.Run(); err != nil {
-		slog.Error("can't run 'sendmidi'", err)
+// SetColors sets the colors of the 8 strips. Units without colored strips ignore it
+func (d mcuDisplay) SetColors(colors [StripCount]string) error {
+	if !d.colors {
+		return nil
 	}
+	hexColors := ""
+	for _, v := range colors {
+		if v == "" {
+			v = "00"
+		}
+		hexColors = hexColors + " " + v
+	}
+	return d.sendSysex(cmdColor + hexColors)
 }
 
-func ClearDisplay(device string, channel uint8) {
-	hexText := ""
-	text := "                            "
-	for _, v := range text {
-		hexText = hexText + fmt.Sprintf(" %X", v)
-	}
+// SetLED sets the LED of the button with the note number, sent as velocity of the note
+func (d mcuDisplay) SetLED(note uint8, mode LEDMode) error {
+	return d.sendmidi(fmt.Sprintf("on %d %d", note&0x7f, mode))
+}
 
-	start := 0 + ((channel - 1) * 7) // upper row
-	app := sendMidi + " dev '" + device + "' hex syx " + MCUvendorId + cmdText + fmt.Sprintf(" %X", start) + hexText
-	cmd := exec.Command("bash", "-c", app)
-	if err := cmd.Run(); err != nil {
-		slog.Error("can't run 'sendmidi'", err)
+// SetRing sets the V-Pot ring of the channel (1-8) by its CC
+func (d mcuDisplay) SetRing(channel uint8, value uint8) error {
+	return d.sendmidi(fmt.Sprintf("cc %d %d", ringCC+channel-1, value&0x7f))
+}
+
+// SetMeters sets the meters of the channels (1-8), each sent as channel pressure with the channel in the upper
+// nibble. All meters are sent by a single sendmidi run, as they are refreshed several times per second
+func (d mcuDisplay) SetMeters(levels map[uint8]uint8) error {
+	if len(levels) == 0 {
+		return nil
+	}
+	args := make([]string, 0, len(levels))
+	for _, channel := range sortedKeys(levels) {
+		args = append(args, fmt.Sprintf("cp %d", (channel-1)<<4|min(levels[channel], meterLevels)))
 	}
+	return d.sendmidi(strings.Join(args, " "))
+}
 
-	time.Sleep(displayRowsDelay * time.Millisecond) // wait a little bit, MCU device might be 'overwhelmed'
+// SetDigit sets a digit of the 7-segment displays by its CC
+func (d mcuDisplay) SetDigit(digit uint8, value uint8) error {
+	return d.sendmidi(fmt.Sprintf("cc %d %d", segmentCC+digit, value&0x7f))
+}
 
-	start = 56 + ((channel - 1) * 7) // lower row
-	app = sendMidi + " dev '" + device + "' hex syx " + MCUvendorId + cmdText + fmt.Sprintf(" %X", start) + hexText
-	cmd = exec.Command("bash", "-c", app)
-	if err := cmd.Run(); err != nil {
-		slog.Error("can't run 'sendmidi'", err)
-	}
-	// set LCD color to white
-	hexText = "07 07 07 07 07 07 07 07"
+// Clear blanks all scribble strips
+func (d mcuDisplay) Clear() error {
+	return d.WriteText(0, strings.Repeat(" ", DisplaySize))
+}
 
-	app = sendMidi + " dev '" + device + "' hex syx " + MCUvendorId + cmdColor + hexText
-	cmd = exec.Command("bash", "-c", app)
-	if err := cmd.Run(); err != nil {
-		slog.Error("can't run 'sendmidi'", err)
-	}
+// Capabilities returns what the unit can show
+func (d mcuDisplay) Capabilities() Capabilities {
+	return Capabilities{Text: true, Colors: d.colors, Controls: true}
 }
@@ -0,0 +1,270 @@
+package devices
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// QueuedDisplay writes to a display asynchronously, so callers (e.g. the event loop) never wait for the device.
+// Pending updates of the same thing are coalesced: characters, the strip colors, the meters and the values of the
+// same control (e.g. one ring) only keep their latest value. The number of pending control updates is bounded, and
+// updates are sent at most with the configured rate
+type QueuedDisplay struct {
+	display Display
+
+	mutex         sync.Mutex
+	clear         bool
+	text          [DisplaySize]byte
+	textPending   [DisplaySize]bool
+	colors        [StripCount]string
+	colorsPending bool
+	meters        map[uint8]uint8 // pending meter levels by channel
+	values        map[control]uint8
+	order         []control // controls of values in order of arrival
+	size          int
+	interval      time.Duration // minimum time between two updates, 0 = unlimited
+	wake          chan struct{}
+	idle          chan struct{} // closed while nothing is pending
+	quit          chan struct{}
+}
+
+// NewQueuedDisplay returns a queue for display and starts its writer goroutine. At most size control updates are
+// pending, the oldest one is dropped when the queue is full. rate limits the updates per second, 0 = unlimited
+func NewQueuedDisplay(display Display, size int, rate int) *QueuedDisplay {
+	q := &QueuedDisplay{display: display, values: map[control]uint8{}, meters: map[uint8]uint8{},
+		wake: make(chan struct{}, 1), idle: make(chan struct{}), quit: make(chan struct{})}
+	close(q.idle)
+	q.SetLimits(size, rate)
+	go q.run()
+	return q
+}
+
+// Display returns the display written by the queue
+func (q *QueuedDisplay) Display() Display {
+	return q.display
+}
+
+// SetLimits changes the maximum number of pending control updates and the updates per second (0 = unlimited)
+func (q *QueuedDisplay) SetLimits(size int, rate int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.size = max(size, 1)
+	q.interval = 0
+	if rate > 0 {
+		q.interval = time.Second / time.Duration(rate)
+	}
+}
+
+// pending marks the queue as not idle and wakes up the writer, the mutex has to be locked
+func (q *QueuedDisplay) pending() {
+	select {
+	case <-q.idle:
+		q.idle = make(chan struct{})
+	default:
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// WriteText queues text for the scribble strips starting at the character offset
+func (q *QueuedDisplay) WriteText(offset int, text string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i := 0; i < len(text); i++ {
+		if offset+i >= 0 && offset+i < DisplaySize {
+			q.text[offset+i] = text[i]
+			q.textPending[offset+i] = true
+		}
+	}
+	q.pending()
+	return nil
+}
+
+// SetColors queues the colors of the 8 strips
+func (q *QueuedDisplay) SetColors(colors [StripCount]string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.colors = colors
+	q.colorsPending = true
+	q.pending()
+	return nil
+}
+
+// controlKind is the kind of a control set by a queued update
+type controlKind uint8
+
+const (
+	ledControl controlKind = iota
+	ringControl
+	digitControl
+)
+
+// controlNames are the names of the control kinds used for logging
+var controlNames = [...]string{ledControl: "LED", ringControl: "ring", digitControl: "digit"}
+
+// control is a button LED, V-Pot ring or 7-segment digit. Queued values of the same control replace each other
+type control struct {
+	kind   controlKind
+	number uint8 // note, channel or digit number
+}
+
+// set sends value to the control of display
+func (c control) set(display Display, value uint8) error {
+	switch c.kind {
+	case ledControl:
+		return display.SetLED(c.number, LEDMode(value))
+	case ringControl:
+		return display.SetRing(c.number, value)
+	default:
+		return display.SetDigit(c.number, value)
+	}
+}
+
+// queue queues the value of a control
+func (q *QueuedDisplay) queue(c control, value uint8) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, ok := q.values[c]; !ok {
+		if len(q.order) >= q.size {
+			slog.Warn("display: queue full, update dropped", "control", controlNames[q.order[0].kind],
+				"number", q.order[0].number)
+			delete(q.values, q.order[0])
+			q.order = q.order[1:]
+		}
+		q.order = append(q.order, c)
+	}
+	q.values[c] = value
+	q.pending()
+	return nil
+}
+
+// SetLED queues the mode of the LED of the button with the note number
+func (q *QueuedDisplay) SetLED(note uint8, mode LEDMode) error {
+	return q.queue(control{kind: ledControl, number: note}, uint8(mode))
+}
+
+// SetRing queues the value of the V-Pot ring of the channel (1-8)
+func (q *QueuedDisplay) SetRing(channel uint8, value uint8) error {
+	return q.queue(control{kind: ringControl, number: channel}, value)
+}
+
+// SetMeters queues the levels of the meters of the channels (1-8). They are sent together
+func (q *QueuedDisplay) SetMeters(levels map[uint8]uint8) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for channel, level := range levels {
+		q.meters[channel] = level
+	}
+	q.pending()
+	return nil
+}
+
+// SetDigit queues the value of a digit of the 7-segment displays
+func (q *QueuedDisplay) SetDigit(digit uint8, value uint8) error {
+	return q.queue(control{kind: digitControl, number: digit}, value)
+}
+
+// Clear queues blanking all scribble strips. Text queued before is dropped
+func (q *QueuedDisplay) Clear() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.clear = true
+	q.textPending = [DisplaySize]bool{}
+	q.pending()
+	return nil
+}
+
+// Capabilities returns the capabilities of the display written by the queue
+func (q *QueuedDisplay) Capabilities() Capabilities {
+	return q.display.Capabilities()
+}
+
+// next removes the next pending update from the queue and returns the function sending it, nil if nothing is
+// pending. Clearing comes first, then the colors, the meters, the text and the controls
+func (q *QueuedDisplay) next() func() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	switch {
+	case q.clear:
+		q.clear = false
+		return q.display.Clear
+	case q.colorsPending:
+		q.colorsPending = false
+		colors := q.colors
+		return func() error { return q.display.SetColors(colors) }
+	case len(q.meters) > 0:
+		meters := q.meters
+		q.meters = map[uint8]uint8{}
+		return func() error { return q.display.SetMeters(meters) }
+	}
+	for i := 0; i < DisplaySize; i++ {
+		if !q.textPending[i] {
+			continue
+		}
+		start := i
+		for i < DisplaySize && q.textPending[i] {
+			q.textPending[i] = false
+			i++
+		}
+		text := string(q.text[start:i])
+		return func() error { return q.display.WriteText(start, text) }
+	}
+	if len(q.order) > 0 {
+		c := q.order[0]
+		value := q.values[c]
+		delete(q.values, c)
+		q.order = q.order[1:]
+		return func() error { return c.set(q.display, value) }
+	}
+	select {
+	case <-q.idle:
+	default:
+		close(q.idle)
+	}
+	return nil
+}
+
+// run is the writer goroutine sending the queued updates until Close is called
+func (q *QueuedDisplay) run() {
+	for {
+		select {
+		case <-q.quit:
+			return
+		case <-q.wake:
+		}
+		for send := q.next(); send != nil; send = q.next() {
+			if err := send(); err != nil {
+				slog.Error("display: can't write", "err", err)
+			}
+			q.mutex.Lock()
+			interval := q.interval
+			q.mutex.Unlock()
+			select {
+			case <-q.quit:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}
+}
+
+// Wait waits until all queued updates are sent, at most for timeout. It reports if the queue is empty
+func (q *QueuedDisplay) Wait(timeout time.Duration) bool {
+	q.mutex.Lock()
+	idle := q.idle
+	q.mutex.Unlock()
+	select {
+	case <-idle:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Close stops the writer goroutine, updates still pending are dropped
+func (q *QueuedDisplay) Close() {
+	close(q.quit)
+}
@@ -0,0 +1,97 @@
+package devices
+
+import (
+	"testing"
+	"time"
+)
+
+// newStoppedQueue returns a queue without its writer goroutine, its updates are sent by sendQueued
+func newStoppedQueue(display Display, size int) *QueuedDisplay {
+	q := &QueuedDisplay{display: display, values: map[control]uint8{}, meters: map[uint8]uint8{},
+		wake: make(chan struct{}, 1), idle: make(chan struct{}), quit: make(chan struct{})}
+	close(q.idle)
+	q.SetLimits(size, 0)
+	return q
+}
+
+// sendQueued sends all pending updates of the queue
+func sendQueued(t *testing.T, q *QueuedDisplay) {
+	t.Helper()
+	for send := q.next(); send != nil; send = q.next() {
+		if err := send(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestQueuedDisplayCoalescing(t *testing.T) {
+	d := newRecordingDisplay()
+	q := newStoppedQueue(d, 10)
+
+	q.SetRing(1, 0x21)
+	q.SetLED(94, LEDOn)
+	q.SetRing(1, 0x25) // replaces the pending value, keeps the position
+	q.SetDigit(0, '1')
+	q.WriteText(0, "abc")
+	q.WriteText(2, "CD")
+	q.WriteText(10, "x")
+	q.SetMeters(map[uint8]uint8{1: 3, 2: 4})
+	q.SetMeters(map[uint8]uint8{1: 5})
+	q.SetColors([StripCount]string{"01"})
+	q.SetColors([StripCount]string{"02"})
+	sendQueued(t, q)
+	assertCalls(t, d, "colors [02       ]", "meters map[1:5 2:4]", "text 0 abCD", "text 10 x", "ring 1 0x25",
+		"led 94 127", "digit 0 0x31")
+
+	q.WriteText(0, "old")
+	q.Clear() // drops the pending text
+	q.WriteText(4, "new")
+	sendQueued(t, q)
+	assertCalls(t, d, "clear", "text 4 new")
+
+	if !q.Wait(time.Second) {
+		t.Error("Wait() = false with nothing pending")
+	}
+	q.SetLED(1, LEDBlink)
+	if q.Wait(time.Millisecond) {
+		t.Error("Wait() = true with pending updates")
+	}
+}
+
+func TestQueuedDisplayDrop(t *testing.T) {
+	d := newRecordingDisplay()
+	q := newStoppedQueue(d, 2)
+
+	q.SetRing(1, 0x21)
+	q.SetRing(2, 0x22)
+	q.SetRing(1, 0x23)     // coalesced, nothing dropped
+	q.SetRing(3, 0x24)     // drops the oldest pending update
+	q.WriteText(0, "text") // not limited
+	sendQueued(t, q)
+	assertCalls(t, d, "text 0 text", "ring 2 0x22", "ring 3 0x24")
+
+	q.SetLimits(0, 0) // at least one update is kept
+	q.SetDigit(1, 1)
+	q.SetDigit(2, 2)
+	sendQueued(t, q)
+	assertCalls(t, d, "digit 2 0x2")
+}
+
+func TestQueuedDisplayWriter(t *testing.T) {
+	d := newRecordingDisplay()
+	q := NewQueuedDisplay(d, 10, 1000)
+	defer q.Close()
+
+	q.SetLED(94, LEDOn)
+	q.SetRing(8, 0x16)
+	if !q.Wait(time.Second) {
+		t.Fatal("queued updates not sent")
+	}
+	assertCalls(t, d, "led 94 127", "ring 8 0x16")
+	if q.Display() != Display(d) {
+		t.Error("Display() doesn't return the queued display")
+	}
+	if q.Capabilities() != d.Capabilities() {
+		t.Error("Capabilities() differ from the queued display")
+	}
+}
@@ -0,0 +1,218 @@
+package devices
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// tuiDisplays contains the terminal displays by output path, so a path is only opened once
+	tuiDisplays      = map[string]*TUIDisplay{}
+	tuiDisplaysMutex sync.Mutex
+)
+
+// TUIDisplay emulates a control surface in a terminal. It shows the scribble strips with their colors, the
+// 7-segment displays, the V-Pot rings, the meters and the button LEDs, redrawn after every change
+type TUIDisplay struct {
+	mutex    sync.Mutex
+	out      io.Writer // nil: only kept for Snapshot
+	text     [DisplaySize]byte
+	colors   [StripCount]string
+	leds     map[uint8]LEDMode
+	rings    map[uint8]uint8 // ring CC values by channel (1-8)
+	meters   map[uint8]uint8 // meter levels (0-12) by channel (1-8)
+	segments map[uint8]uint8 // digit values by digit number
+}
+
+// NewTUIDisplay returns the terminal display writing to the file or terminal device at path, e.g. /dev/ttys003.
+// "" and "stdout" write to the standard output. The same path always returns the same display
+func NewTUIDisplay(path string) (*TUIDisplay, error) {
+	tuiDisplaysMutex.Lock()
+	defer tuiDisplaysMutex.Unlock()
+	if d, ok := tuiDisplays[path]; ok {
+		return d, nil
+	}
+	var out io.Writer = os.Stdout
+	if path != "" && path != "stdout" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	d := NewTUIWriter(out)
+	tuiDisplays[path] = d
+	return d, nil
+}
+
+// NewTUIWriter returns a terminal display writing to out. With out nil nothing is drawn, the content is only
+// available by Snapshot
+func NewTUIWriter(out io.Writer) *TUIDisplay {
+	d := &TUIDisplay{out: out, leds: map[uint8]LEDMode{}, rings: map[uint8]uint8{}, meters: map[uint8]uint8{},
+		segments: map[uint8]uint8{}}
+	for i := range d.text {
+		d.text[i] = ' '
+	}
+	return d
+}
+
+// WriteText writes text to the scribble strips starting at the character offset
+func (d *TUIDisplay) WriteText(offset int, text string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i := 0; i < len(text); i++ {
+		if offset+i >= 0 && offset+i < DisplaySize {
+			d.text[offset+i] = text[i]
+		}
+	}
+	return d.draw()
+}
+
+// SetColors sets the colors of the 8 strips
+func (d *TUIDisplay) SetColors(colors [StripCount]string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.colors = colors
+	return d.draw()
+}
+
+// SetLED sets the LED of the button with the note number
+func (d *TUIDisplay) SetLED(note uint8, mode LEDMode) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.leds[note&0x7f] = mode
+	return d.draw()
+}
+
+// SetRing sets the V-Pot ring of the channel (1-8)
+func (d *TUIDisplay) SetRing(channel uint8, value uint8) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.rings[channel] = value
+	return d.draw()
+}
+
+// SetMeters sets the meters of the channels (1-8) to the levels (0-12)
+func (d *TUIDisplay) SetMeters(levels map[uint8]uint8) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for channel, level := range levels {
+		d.meters[channel] = min(level, meterLevels)
+	}
+	return d.draw()
+}
+
+// SetDigit sets a digit of the 7-segment displays
+func (d *TUIDisplay) SetDigit(digit uint8, value uint8) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.segments[digit] = value
+	return d.draw()
+}
+
+// Clear blanks all scribble strips
+func (d *TUIDisplay) Clear() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i := range d.text {
+		d.text[i] = ' '
+	}
+	return d.draw()
+}
+
+// Capabilities returns what the terminal display can show, i.e. everything
+func (d *TUIDisplay) Capabilities() Capabilities {
+	return Capabilities{Text: true, Colors: true, Controls: true}
+}
+
+// Snapshot returns the content of the display as plain text without colors
+func (d *TUIDisplay) Snapshot() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.render(false)
+}
+
+// draw redraws the display in the terminal, the mutex has to be locked
+func (d *TUIDisplay) draw() error {
+	if d.out == nil {
+		return nil
+	}
+	_, err := io.WriteString(d.out, "\x1b[H\x1b[2J"+d.render(true))
+	return err
+}
+
+// render returns the content of the display. With ansi set the strips are colored by ANSI escape sequences
+func (d *TUIDisplay) render(ansi bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %s\n", segmentText(d.segments, assignmentDigit, AssignmentDigits),
+		segmentText(d.segments, timecodeDigit, TimecodeDigits))
+	for row := 0; row < 2; row++ {
+		for i := 0; i < StripCount; i++ {
+			cell := string(d.text[row*RowLength+i*StripWidth : row*RowLength+(i+1)*StripWidth])
+			if color := d.colors[i]; ansi && len(color) == 2 && color != "00" {
+				cell = "\x1b[30;4" + color[1:] + "m" + cell + "\x1b[0m"
+			}
+			b.WriteString("|" + cell)
+		}
+		b.WriteString("|\n")
+	}
+	b.WriteString("rings: ")
+	for _, channel := range sortedKeys(d.rings) {
+		fmt.Fprintf(&b, " %d[%s]", channel, ringBar(d.rings[channel]))
+	}
+	b.WriteString("\nmeters:")
+	for _, channel := range sortedKeys(d.meters) {
+		fmt.Fprintf(&b, " %d[%-12s]", channel, strings.Repeat("#", int(min(d.meters[channel], meterLevels))))
+	}
+	b.WriteString("\nLEDs:  ")
+	for _, note := range sortedKeys(d.leds) {
+		switch d.leds[note] {
+		case LEDOn:
+			fmt.Fprintf(&b, " %d:on", note)
+		case LEDBlink:
+			fmt.Fprintf(&b, " %d:blink", note)
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// ringBar returns the LEDs of a V-Pot ring CC value as text, 'o' on and '.' off
+func ringBar(value uint8) string {
+	mode, position := RingMode(value>>4&0x03), int(value&0x0f)
+	center := ringLEDs/2 + 1
+	bar := make([]byte, ringLEDs)
+	for i := range bar {
+		led := i + 1
+		on := false
+		switch mode {
+		case RingDot:
+			on = led == position
+		case RingFill:
+			on = led <= position
+		case RingSpread:
+			on = position > 0 && led-center < position && center-led < position
+		default: // boost/cut, from the center to the position
+			on = position > 0 && (led >= min(center, position) && led <= max(center, position))
+		}
+		bar[i] = '.'
+		if on {
+			bar[i] = 'o'
+		}
+	}
+	return string(bar)
+}
+
+// sortedKeys returns the keys of the map in ascending order
+func sortedKeys[V any](m map[uint8]V) []uint8 {
+	keys := make([]uint8, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
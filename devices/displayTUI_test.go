@@ -0,0 +1,80 @@
+package devices
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRingBar(t *testing.T) {
+	tests := []struct {
+		value uint8
+		want  string
+	}{
+		{0x00, "..........."},
+		{0x06, ".....o....."},
+		{0x0b, "..........o"},
+		{0x24, "oooo......."},
+		{0x2b, "ooooooooooo"},
+		{0x31, ".....o....."},
+		{0x33, "...ooooo..."},
+		{0x36, "ooooooooooo"},
+		{0x13, "..oooo....."}, // boost/cut, from the position to the center
+	}
+	for _, tt := range tests {
+		if got := ringBar(tt.value); got != tt.want {
+			t.Errorf("ringBar(%#x) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTUIDisplaySnapshot(t *testing.T) {
+	d := NewTUIWriter(nil)
+	d.WriteText(0, "LR on")
+	d.WriteText(RowLength+7*StripWidth, "-Dim-")
+	d.WriteText(DisplaySize-2, "cut off")
+	d.SetColors([StripCount]string{"01", "", "07"})
+	d.SetLED(94, LEDOn)
+	d.SetLED(93, LEDBlink)
+	d.SetLED(92, LEDOff)
+	d.SetRing(2, 0x26)
+	d.SetMeters(map[uint8]uint8{1: 12, 3: 20})
+	d.SetDigit(assignmentDigit+1, segmentChar('P'))
+	d.SetDigit(assignmentDigit, segmentChar('1'))
+	d.SetDigit(timecodeDigit+1, segmentChar('7')|segmentDot)
+	d.SetDigit(timecodeDigit, segmentChar('5'))
+
+	want := strings.Join([]string{
+		"P1          7.5",
+		"|LR on  |       |       |       |       |       |       |       |",
+		"|       |       |       |       |       |       |       |-Dim-cu|",
+		"rings:  2[oooooo.....]",
+		"meters: 1[############] 3[############]",
+		"LEDs:   93:blink 94:on",
+		""}, "\n")
+	if got := d.Snapshot(); got != want {
+		t.Errorf("Snapshot() =\n%s\nwant\n%s", got, want)
+	}
+
+	d.Clear()
+	if got := d.Snapshot(); !strings.Contains(got, "\n|       |       |       |       |       |       |       |       |\n") {
+		t.Errorf("strips not blank after Clear:\n%s", got)
+	}
+	if d.Capabilities() != (Capabilities{Text: true, Colors: true, Controls: true}) {
+		t.Error("the terminal display must show everything")
+	}
+}
+
+func TestTUIDisplayDraw(t *testing.T) {
+	var out bytes.Buffer
+	d := NewTUIWriter(&out)
+	d.SetColors([StripCount]string{"01"})
+	d.WriteText(0, "LR on")
+	got := out.String()
+	if !strings.HasPrefix(got[strings.LastIndex(got, "\x1b[H"):], "\x1b[H\x1b[2J") {
+		t.Errorf("display not redrawn from the top: %q", got)
+	}
+	if !strings.Contains(got, "\x1b[30;41mLR on  \x1b[0m") {
+		t.Errorf("colored strip missing: %q", got)
+	}
+}
@@ -0,0 +1,79 @@
+package devices
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingDisplay records the calls of the Display methods as text, e.g. "text 3 abc"
+type recordingDisplay struct {
+	mutex        sync.Mutex
+	capabilities Capabilities
+	calls        []string
+}
+
+func newRecordingDisplay() *recordingDisplay {
+	return &recordingDisplay{capabilities: Capabilities{Text: true, Colors: true, Controls: true}}
+}
+
+func (d *recordingDisplay) record(format string, args ...interface{}) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.calls = append(d.calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+// takeCalls returns the calls recorded since the last call of takeCalls
+func (d *recordingDisplay) takeCalls() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	calls := d.calls
+	d.calls = nil
+	return calls
+}
+
+func (d *recordingDisplay) WriteText(offset int, text string) error {
+	return d.record("text %d %s", offset, text)
+}
+
+func (d *recordingDisplay) SetColors(colors [StripCount]string) error {
+	return d.record("colors %v", colors)
+}
+
+func (d *recordingDisplay) SetLED(note uint8, mode LEDMode) error {
+	return d.record("led %d %d", note, mode)
+}
+
+func (d *recordingDisplay) SetRing(channel uint8, value uint8) error {
+	return d.record("ring %d %#x", channel, value)
+}
+
+func (d *recordingDisplay) SetMeters(levels map[uint8]uint8) error {
+	return d.record("meters %v", levels) // fmt prints maps sorted by key
+}
+
+func (d *recordingDisplay) SetDigit(digit uint8, value uint8) error {
+	return d.record("digit %d %#x", digit, value)
+}
+
+func (d *recordingDisplay) Clear() error {
+	return d.record("clear")
+}
+
+func (d *recordingDisplay) Capabilities() Capabilities {
+	return d.capabilities
+}
+
+// assertCalls fails if the calls recorded since the last check differ from want
+func assertCalls(t *testing.T, d *recordingDisplay, want ...string) {
+	t.Helper()
+	got := d.takeCalls()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("calls:\n%q\nwant:\n%q", got, want)
+	}
+}
@@ -0,0 +1,292 @@
+package devices
+
+import (
+	"strings"
+	"sync"
+)
+
+// layout of the MCU scribble strips: 2 rows of 56 characters, split into 8 strips of 7 characters
+const (
+	StripWidth    = 7
+	StripCount    = 8
+	RowLength     = StripWidth * StripCount
+	DisplaySize   = 2 * RowLength
+	sysexOverhead = 8 // bytes of a text sysex message besides the characters: F0, vendor ID, command, offset, F7
+)
+
+// Align defines how text shorter than its region is placed
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+)
+
+// Region is an area of the display, starting at a character offset (0-55 upper row, 56-111 lower row)
+type Region struct {
+	Offset int
+	Width  int
+	Align  Align
+}
+
+// CellRegion returns the region of the strip of a channel (1-8) in the row (0 upper, 56 lower)
+func CellRegion(channel uint8, row uint8) Region {
+	return Region{Offset: int(row) + (int(channel)-1)*StripWidth, Width: StripWidth}
+}
+
+// StripsRegion returns the region of count strips starting with the strip of the channel (1-8) in the row
+func StripsRegion(channel uint8, row uint8, count int) Region {
+	r := CellRegion(channel, row)
+	r.Width = count * StripWidth
+	return r
+}
+
+// fit aligns and truncates text to the width of the region. Characters the display can't show are replaced by '?'
+func (r Region) fit(text string) []byte {
+	chars := make([]byte, 0, len(text))
+	for _, v := range text {
+		if v < 0x20 || v > 0x7e {
+			v = '?'
+		}
+		chars = append(chars, byte(v))
+	}
+	if len(chars) > r.Width {
+		chars = chars[:r.Width]
+	}
+	padding := r.Width - len(chars)
+	left := 0
+	switch r.Align {
+	case AlignCenter:
+		left = padding / 2
+	case AlignRight:
+		left = padding
+	}
+	return []byte(strings.Repeat(" ", left) + string(chars) + strings.Repeat(" ", padding-left))
+}
+
+// Framebuffer holds the content of the scribble strips and the content the device currently shows. Flush sends
+// only the characters that differ. Characters never written aren't sent at all, so other software (e.g. the DAW)
+// can use the remaining strips. The strip colors can only be sent all at once, they are sent when any of them changed.
+// Blinking characters and colors keep their content, they are only hidden while the blink phase is off
+type Framebuffer struct {
+	mutex        sync.Mutex
+	display      Display
+	regions      map[string]Region
+	content      [DisplaySize]byte
+	shown        [DisplaySize]byte
+	owned        [DisplaySize]bool // the character was written, it belongs to the framebuffer
+	synced       [DisplaySize]bool // shown is known to be on the device
+	colors       [StripCount]string
+	shownColors  [StripCount]string
+	colorsSynced bool
+	blink        [DisplaySize]bool
+	blinkColor   [StripCount]bool
+	blinkHidden  bool // blink phase: blinking characters are blank and blinking strips are off
+}
+
+// NewFramebuffer returns an empty framebuffer
+func NewFramebuffer() *Framebuffer {
+	fb := &Framebuffer{regions: map[string]Region{}}
+	for i := range fb.content {
+		fb.content[i] = ' '
+	}
+	return fb
+}
+
+// SetDisplay sets the display. Changing it sends the complete content with the next Flush
+func (fb *Framebuffer) SetDisplay(display Display) {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	if display != fb.display {
+		fb.display = display
+		fb.synced = [DisplaySize]bool{}
+		fb.colorsSynced = false
+	}
+}
+
+// DefineRegion names a region, so it can be written by name
+func (fb *Framebuffer) DefineRegion(name string, r Region) {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	fb.regions[name] = r
+}
+
+// Write writes text to the named region. Unknown names are ignored
+func (fb *Framebuffer) Write(name string, text string) {
+	fb.mutex.Lock()
+	r, ok := fb.regions[name]
+	fb.mutex.Unlock()
+	if ok {
+		fb.WriteRegion(r, text)
+	}
+}
+
+// WriteRegion writes text aligned and truncated to the region
+func (fb *Framebuffer) WriteRegion(r Region, text string) {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	for i, v := range r.fit(text) {
+		if r.Offset+i >= 0 && r.Offset+i < DisplaySize {
+			fb.content[r.Offset+i] = v
+			fb.owned[r.Offset+i] = true
+		}
+	}
+}
+
+// Clear blanks all characters written so far
+func (fb *Framebuffer) Clear() {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	for i := range fb.content {
+		fb.content[i] = ' '
+	}
+}
+
+// Invalidate forgets what the device shows, the next Flush sends the complete content
+func (fb *Framebuffer) Invalidate() {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	fb.synced = [DisplaySize]bool{}
+	fb.colorsSynced = false
+}
+
+// SetColor sets the color of the strip of a channel (1-8) as hex byte ("00" off - "07" white). Strips without a color
+// are switched off once any color is set
+func (fb *Framebuffer) SetColor(channel uint8, color string) {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	if channel >= 1 && channel <= StripCount {
+		fb.colors[channel-1] = color
+	}
+}
+
+// Color returns the color of the strip of a channel (1-8), "" if it wasn't set
+func (fb *Framebuffer) Color(channel uint8) string {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	if channel < 1 || channel > StripCount {
+		return ""
+	}
+	return fb.colors[channel-1]
+}
+
+// SetBlink starts or stops blinking the characters of the region
+func (fb *Framebuffer) SetBlink(r Region, on bool) {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	for i := r.Offset; i < r.Offset+r.Width; i++ {
+		if i >= 0 && i < DisplaySize {
+			fb.blink[i] = on
+		}
+	}
+}
+
+// SetColorBlink starts or stops blinking the color of the strip of a channel (1-8)
+func (fb *Framebuffer) SetColorBlink(channel uint8, on bool) {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	if channel >= 1 && channel <= StripCount {
+		fb.blinkColor[channel-1] = on
+	}
+}
+
+// SetBlinkPhase shows (visible) or hides the blinking characters and colors with the next Flush
+func (fb *Framebuffer) SetBlinkPhase(visible bool) {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	fb.blinkHidden = !visible
+}
+
+// visible returns the character at offset i as shown in the current blink phase
+func (fb *Framebuffer) visible(i int) byte {
+	if fb.blinkHidden && fb.blink[i] {
+		return ' '
+	}
+	return fb.content[i]
+}
+
+// visibleColors returns the strip colors as shown in the current blink phase
+func (fb *Framebuffer) visibleColors() [StripCount]string {
+	colors := fb.colors
+	for i := range colors {
+		if fb.blinkHidden && fb.blinkColor[i] && colors[i] != "" {
+			colors[i] = "00"
+		}
+	}
+	return colors
+}
+
+// Text returns the content of a row (0 upper, 1 lower)
+func (fb *Framebuffer) Text(row int) string {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	return string(fb.content[row*RowLength : (row+1)*RowLength])
+}
+
+// dirty reports if the character at offset i has to be sent
+func (fb *Framebuffer) dirty(i int) bool {
+	return fb.owned[i] && (!fb.synced[i] || fb.shown[i] != fb.visible(i))
+}
+
+// changedRuns returns the ranges [start, end) of characters to send. Runs separated by fewer unchanged characters
+// than the overhead of a message are merged, as long as the characters in between belong to the framebuffer
+func (fb *Framebuffer) changedRuns() [][2]int {
+	runs := [][2]int{}
+	for i := 0; i < DisplaySize; i++ {
+		if !fb.dirty(i) {
+			continue
+		}
+		start := i
+		for i < DisplaySize && fb.dirty(i) {
+			i++
+		}
+		if n := len(runs); n > 0 && start-runs[n-1][1] <= sysexOverhead && fb.ownedRange(runs[n-1][1], start) {
+			runs[n-1][1] = i
+		} else {
+			runs = append(runs, [2]int{start, i})
+		}
+	}
+	return runs
+}
+
+// ownedRange reports if all characters in [start, end) belong to the framebuffer
+func (fb *Framebuffer) ownedRange(start int, end int) bool {
+	for i := start; i < end; i++ {
+		if !fb.owned[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Flush sends the changed colors and characters to the device, using as few sysex messages as possible
+func (fb *Framebuffer) Flush() error {
+	fb.mutex.Lock()
+	defer fb.mutex.Unlock()
+	if fb.display == nil || !fb.display.Capabilities().Text {
+		return nil
+	}
+	colors := fb.visibleColors()
+	if fb.display.Capabilities().Colors && colors != [StripCount]string{} && (!fb.colorsSynced || colors != fb.shownColors) {
+		if err := fb.display.SetColors(colors); err != nil {
+			return err
+		}
+		fb.shownColors = colors
+		fb.colorsSynced = true
+	}
+	for _, run := range fb.changedRuns() {
+		text := make([]byte, 0, run[1]-run[0])
+		for i := run[0]; i < run[1]; i++ {
+			text = append(text, fb.visible(i))
+		}
+		if err := fb.display.WriteText(run[0], string(text)); err != nil {
+			return err
+		}
+		for i := run[0]; i < run[1]; i++ {
+			fb.shown[i] = fb.visible(i)
+			fb.synced[i] = true
+		}
+	}
+	return nil
+}
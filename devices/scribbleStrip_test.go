@@ -0,0 +1,112 @@
+package devices
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegionFit(t *testing.T) {
+	tests := []struct {
+		name   string
+		region Region
+		text   string
+		want   string
+	}{
+		{"left", Region{Width: 7}, "LR", "LR     "},
+		{"center", Region{Width: 7, Align: AlignCenter}, "LR", "  LR   "},
+		{"right", Region{Width: 7, Align: AlignRight}, "LR", "     LR"},
+		{"truncated", Region{Width: 3}, "Monitor", "Mon"},
+		{"not printable", Region{Width: 4}, "a\tb€", "a?b?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.region.fit(tt.text)); got != tt.want {
+				t.Errorf("fit(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFramebufferChangedRuns(t *testing.T) {
+	tests := []struct {
+		name   string
+		synced string // written and flushed before the changes
+		write  []Region
+		want   [][2]int
+	}{
+		{"nothing written", "", nil, [][2]int{}},
+		{"one region", "", []Region{{Offset: 3, Width: 4}}, [][2]int{{3, 7}}},
+		{"unowned gap", "", []Region{{Offset: 0, Width: 2}, {Offset: 5, Width: 2}}, [][2]int{{0, 2}, {5, 7}}},
+		{"small owned gap merged", "owned", []Region{{Offset: 0, Width: 2}, {Offset: 10, Width: 2}},
+			[][2]int{{0, 12}}},
+		{"large owned gap", "owned", []Region{{Offset: 0, Width: 2}, {Offset: 11, Width: 2}},
+			[][2]int{{0, 2}, {11, 13}}},
+		{"lower row", "", []Region{CellRegion(8, RowLength)}, [][2]int{{DisplaySize - StripWidth, DisplaySize}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fb := NewFramebuffer()
+			fb.SetDisplay(newRecordingDisplay())
+			if tt.synced != "" {
+				fb.WriteRegion(Region{Width: 20}, "")
+				fb.Flush()
+			}
+			for _, r := range tt.write {
+				fb.WriteRegion(r, "xxxxxxx")
+			}
+			if got := fb.changedRuns(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changedRuns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFramebufferFlush(t *testing.T) {
+	d := newRecordingDisplay()
+	fb := NewFramebuffer()
+	fb.DefineRegion("status", CellRegion(8, RowLength))
+	fb.SetDisplay(d)
+
+	fb.WriteRegion(CellRegion(1, 0), "LR on")
+	fb.Write("status", "Monitor")
+	fb.Write("unknown", "ignored")
+	fb.Flush()
+	assertCalls(t, d, "text 0 LR on  ", "text 105 Monitor")
+
+	fb.Flush()
+	assertCalls(t, d) // unchanged
+
+	fb.WriteRegion(CellRegion(1, 0), "LR off")
+	fb.Flush()
+	assertCalls(t, d, "text 4 ff")
+
+	fb.SetColor(1, "03")
+	fb.SetColor(9, "07") // no such strip
+	fb.Flush()
+	assertCalls(t, d, "colors [03       ]")
+
+	fb.Invalidate()
+	fb.Flush()
+	assertCalls(t, d, "colors [03       ]", "text 0 LR off ", "text 105 Monitor")
+
+	fb.SetBlink(CellRegion(8, RowLength), true)
+	fb.SetColorBlink(1, true)
+	fb.SetBlinkPhase(false)
+	fb.Flush()
+	assertCalls(t, d, "colors [00       ]", "text 105        ")
+	fb.SetBlinkPhase(true)
+	fb.Flush()
+	assertCalls(t, d, "colors [03       ]", "text 105 Monitor")
+
+	fb.Clear()
+	fb.Flush()
+	assertCalls(t, d, "text 0       ", "text 105        ") // the trailing blank of "LR off " is unchanged
+	if got := fb.Text(0); got[:StripWidth] != "       " {
+		t.Errorf("Text(0) = %q after Clear", got)
+	}
+
+	d.capabilities = Capabilities{}
+	fb.WriteRegion(CellRegion(1, 0), "LR on")
+	fb.Flush()
+	assertCalls(t, d) // display without scribble strips
+}
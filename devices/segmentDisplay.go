@@ -0,0 +1,159 @@
+package devices
+
+import (
+	"strings"
+	"sync"
+)
+
+// MCU 7-segment displays, each digit is set by its own CC. The digits are numbered from the rightmost one
+const (
+	TimecodeDigits   = 10
+	AssignmentDigits = 2
+	timecodeDigit    = 0    // rightmost timecode digit, the leftmost one is 9
+	assignmentDigit  = 10   // right assignment digit, the left one is 11
+	segmentCC        = 0x40 // CC number of digit 0, digit 11 is 0x4b
+	segmentDot       = 0x40 // added to a digit to light its decimal point
+)
+
+// segmentChar returns the digit value of a character: '@'-'_' are sent as 0x00-0x1f, ' '-'?' as 0x20-0x3f. Lower
+// case letters are shown as upper case, other characters as blank
+func segmentChar(c byte) uint8 {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch {
+	case c >= 0x40 && c <= 0x5f:
+		return c - 0x40
+	case c >= 0x20 && c <= 0x3f:
+		return c
+	}
+	return ' '
+}
+
+// segmentDigits returns the digit values of text right aligned and truncated to count digits. A '.' lights the
+// decimal point of the preceding character instead of using a digit of its own
+func segmentDigits(text string, count int) []uint8 {
+	digits := []uint8{}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '.' && len(digits) > 0 && digits[len(digits)-1]&segmentDot == 0 {
+			digits[len(digits)-1] |= segmentDot
+			continue
+		}
+		digits = append(digits, segmentChar(text[i]))
+	}
+	if len(digits) > count {
+		digits = digits[:count]
+	}
+	padding := make([]uint8, count-len(digits))
+	for i := range padding {
+		padding[i] = ' '
+	}
+	return append(padding, digits...)
+}
+
+// SegmentDisplay holds the content of the timecode and assignment displays and the content the device currently
+// shows. Flush sends only the changed digits. Digits never written aren't sent at all, so other software (e.g. the
+// DAW) can use the displays
+type SegmentDisplay struct {
+	mutex   sync.Mutex
+	display Display
+	digits  map[uint8]uint8 // digit values by digit number
+	shown   map[uint8]uint8 // digit values known to be on the device
+}
+
+// NewSegmentDisplay returns a segment display without any digit written
+func NewSegmentDisplay() *SegmentDisplay {
+	return &SegmentDisplay{digits: map[uint8]uint8{}, shown: map[uint8]uint8{}}
+}
+
+// SetDisplay sets the control surface. Changing it sends all digits with the next Flush
+func (s *SegmentDisplay) SetDisplay(display Display) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if display != s.display {
+		s.display = display
+		s.shown = map[uint8]uint8{}
+	}
+}
+
+// write sets count digits starting with the rightmost one at digit number first
+func (s *SegmentDisplay) write(first uint8, count int, text string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, v := range segmentDigits(text, count) {
+		s.digits[first+uint8(count-1-i)] = v
+	}
+}
+
+// WriteTimecode writes text right aligned to the 10 digits of the timecode display
+func (s *SegmentDisplay) WriteTimecode(text string) {
+	s.write(timecodeDigit, TimecodeDigits, text)
+}
+
+// WriteAssignment writes text right aligned to the 2 digits of the assignment display
+func (s *SegmentDisplay) WriteAssignment(text string) {
+	s.write(assignmentDigit, AssignmentDigits, text)
+}
+
+// Clear blanks all digits written so far
+func (s *SegmentDisplay) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for k := range s.digits {
+		s.digits[k] = ' '
+	}
+}
+
+// Invalidate forgets what the device shows, the next Flush sends all digits
+func (s *SegmentDisplay) Invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.shown = map[uint8]uint8{}
+}
+
+// segmentText returns the text shown by count digits starting with the rightmost one at digit number first. Digits
+// missing in digits are blank
+func segmentText(digits map[uint8]uint8, first uint8, count int) string {
+	var b strings.Builder
+	for i := count - 1; i >= 0; i-- {
+		v, ok := digits[first+uint8(i)]
+		if !ok {
+			v = ' '
+		}
+		c := v &^ segmentDot
+		if c < 0x20 {
+			c += 0x40
+		}
+		b.WriteByte(c)
+		if v&segmentDot != 0 {
+			b.WriteByte('.')
+		}
+	}
+	return b.String()
+}
+
+// Text returns the content of the timecode and the assignment display
+func (s *SegmentDisplay) Text() (string, string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return segmentText(s.digits, timecodeDigit, TimecodeDigits), segmentText(s.digits, assignmentDigit, AssignmentDigits)
+}
+
+// Flush sends the changed digits to the device
+func (s *SegmentDisplay) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.display == nil || !s.display.Capabilities().Controls {
+		return nil
+	}
+	for digit, value := range s.digits {
+		if shown, ok := s.shown[digit]; ok && shown == value {
+			continue
+		}
+		if err := s.display.SetDigit(digit, value); err != nil {
+			return err
+		}
+		s.shown[digit] = value
+	}
+	return nil
+}
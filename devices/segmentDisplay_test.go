@@ -0,0 +1,95 @@
+package devices
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSegmentChar(t *testing.T) {
+	tests := []struct {
+		c    byte
+		want uint8
+	}{
+		{'@', 0x00},
+		{'A', 0x01},
+		{'a', 0x01},
+		{'P', 0x10},
+		{'_', 0x1f},
+		{' ', 0x20},
+		{'-', 0x2d},
+		{'0', 0x30},
+		{'9', 0x39},
+		{'~', 0x20}, // not shown
+	}
+	for _, tt := range tests {
+		if got := segmentChar(tt.c); got != tt.want {
+			t.Errorf("segmentChar(%q) = %#x, want %#x", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestSegmentDigits(t *testing.T) {
+	tests := []struct {
+		text  string
+		count int
+		want  []uint8
+	}{
+		{"", 2, []uint8{0x20, 0x20}},
+		{"P1", 2, []uint8{0x10, 0x31}},
+		{"7", 2, []uint8{0x20, 0x37}},
+		{"1.5", 3, []uint8{0x20, 0x71, 0x35}},
+		{"..", 2, []uint8{0x20, 0x6e}}, // the second dot lights the point of the first
+		{"ABCD", 2, []uint8{0x01, 0x02}},
+	}
+	for _, tt := range tests {
+		if got := segmentDigits(tt.text, tt.count); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("segmentDigits(%q, %d) = %#x, want %#x", tt.text, tt.count, got, tt.want)
+		}
+	}
+}
+
+// assertDigitCalls is assertCalls ignoring the order, the digits are sent in map order
+func assertDigitCalls(t *testing.T, d *recordingDisplay, want ...string) {
+	t.Helper()
+	got := d.takeCalls()
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) || (len(got) > 0 && !reflect.DeepEqual(got, want)) {
+		t.Errorf("calls:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestSegmentDisplay(t *testing.T) {
+	d := newRecordingDisplay()
+	s := NewSegmentDisplay()
+	s.SetDisplay(d)
+
+	s.WriteAssignment("P1")
+	s.WriteTimecode("-12.5 dB")
+	timecode, assignment := s.Text()
+	if timecode != "   -12.5 DB" || assignment != "P1" {
+		t.Errorf("Text() = %q, %q", timecode, assignment)
+	}
+
+	s.Flush()
+	assertDigitCalls(t, d, "digit 11 0x10", "digit 10 0x31", "digit 9 0x20", "digit 8 0x20", "digit 7 0x20",
+		"digit 6 0x2d", "digit 5 0x31", "digit 4 0x72", "digit 3 0x35", "digit 2 0x20", "digit 1 0x4", "digit 0 0x2")
+	s.Flush()
+	assertDigitCalls(t, d)
+
+	s.WriteAssignment("P2")
+	s.Flush()
+	assertDigitCalls(t, d, "digit 10 0x32")
+
+	s.Clear()
+	s.Invalidate()
+	d.capabilities = Capabilities{Text: true}
+	s.Flush()
+	assertDigitCalls(t, d) // display without controls
+	d.capabilities = Capabilities{Controls: true}
+	s.Flush()
+	if calls := d.takeCalls(); len(calls) != TimecodeDigits+AssignmentDigits {
+		t.Errorf("%d digits sent after Invalidate, want %d", len(calls), TimecodeDigits+AssignmentDigits)
+	}
+}
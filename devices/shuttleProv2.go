@@ -178,6 +178,11 @@ func (shuttlePro *ShuttleProV2) readDevice() {
 	}
 }
 
+// IsShuttleProV2 reports if the HID device is a ShuttlePRO v2
+func IsShuttleProV2(info hid.DeviceInfo) bool {
+	return info.VendorID == shuttleProV2VendorId && info.ProductID == shuttleProV2ProductId
+}
+
 // NewShuttleProV2 searches for available ShuttleProv2 devices and opens the first one it finds
 func NewShuttleProV2() (*ShuttleProV2, error) {
 	deviceInfo := hid.Enumerate(shuttleProV2VendorId, shuttleProV2ProductId)
@@ -0,0 +1,139 @@
+package devices
+
+import "sync"
+
+// RingMode is the way a value is shown on the LED ring of an MCU V-Pot
+type RingMode uint8
+
+const (
+	RingDot    RingMode = 0 // a single LED at the position of the value
+	RingFill   RingMode = 2 // all LEDs from the left up to the value
+	RingSpread RingMode = 3 // LEDs spreading from the center to both sides with the value
+)
+
+// MCU V-Pot rings and meters
+const (
+	ringCC      = 0x30 // CC number of the ring of channel 1, channel 8 is 0x37
+	ringLEDs    = 11
+	meterLevels = 12 // levels of a channel meter, sent as channel pressure
+)
+
+// ringValue returns the ring CC value showing value (0-127) in the mode. Value 0 switches all LEDs off
+func ringValue(mode RingMode, value uint8) uint8 {
+	value &= 0x7f
+	if value == 0 {
+		return uint8(mode) << 4
+	}
+	positions := ringLEDs
+	if mode == RingSpread {
+		positions = ringLEDs/2 + 1
+	}
+	return uint8(mode)<<4 | uint8(1+int(value-1)*(positions-1)/126)
+}
+
+// meterLevel returns the meter level (0-12) showing value (0-127)
+func meterLevel(value uint8) uint8 {
+	return uint8(int(value&0x7f) * meterLevels / 127)
+}
+
+// VPotRings holds the values of the V-Pot LED rings and channel meters. Flush sends only the changed rings. Rings
+// and meters never set aren't sent at all, so other software (e.g. the DAW) can use them. The meters fall back on
+// their own, RefreshMeters has to be called periodically to keep them up
+type VPotRings struct {
+	mutex   sync.Mutex
+	display Display
+	rings   map[uint8]uint8 // ring CC values by channel (1-8)
+	shown   map[uint8]uint8 // ring CC values known to be on the device
+	meters  map[uint8]uint8 // meter values (0-127) by channel (1-8)
+}
+
+// NewVPotRings returns rings and meters without any value set
+func NewVPotRings() *VPotRings {
+	return &VPotRings{rings: map[uint8]uint8{}, shown: map[uint8]uint8{}, meters: map[uint8]uint8{}}
+}
+
+// SetDisplay sets the control surface. Changing it sends all rings with the next Flush
+func (r *VPotRings) SetDisplay(display Display) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if display != r.display {
+		r.display = display
+		r.shown = map[uint8]uint8{}
+	}
+}
+
+// SetRing shows value (0-127) in the mode on the ring of the channel (1-8)
+func (r *VPotRings) SetRing(channel uint8, mode RingMode, value uint8) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if channel >= 1 && channel <= StripCount {
+		r.rings[channel] = ringValue(mode, value)
+	}
+}
+
+// SetMeter shows value (0-127) on the meter of the channel (1-8)
+func (r *VPotRings) SetMeter(channel uint8, value uint8) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if channel >= 1 && channel <= StripCount {
+		r.meters[channel] = value
+	}
+}
+
+// Clear switches all rings set so far off and stops the meters
+func (r *VPotRings) Clear() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for k := range r.rings {
+		r.rings[k] = 0
+	}
+	r.meters = map[uint8]uint8{}
+}
+
+// Invalidate forgets what the device shows, the next Flush sends all rings
+func (r *VPotRings) Invalidate() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.shown = map[uint8]uint8{}
+}
+
+// Flush sends the changed rings and all meters to the device
+func (r *VPotRings) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.display == nil || !r.display.Capabilities().Controls {
+		return nil
+	}
+	for channel, value := range r.rings {
+		if shown, ok := r.shown[channel]; ok && shown == value {
+			continue
+		}
+		if err := r.display.SetRing(channel, value); err != nil {
+			return err
+		}
+		r.shown[channel] = value
+	}
+	return r.sendMeters()
+}
+
+// RefreshMeters sends all meters again before they fall back
+func (r *VPotRings) RefreshMeters() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.display == nil || !r.display.Capabilities().Controls {
+		return nil
+	}
+	return r.sendMeters()
+}
+
+// sendMeters sends the values of all meters at once, the mutex has to be locked
+func (r *VPotRings) sendMeters() error {
+	if len(r.meters) == 0 {
+		return nil
+	}
+	levels := make(map[uint8]uint8, len(r.meters))
+	for channel, value := range r.meters {
+		levels[channel] = meterLevel(value)
+	}
+	return r.display.SetMeters(levels)
+}
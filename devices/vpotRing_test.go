@@ -0,0 +1,79 @@
+package devices
+
+import "testing"
+
+func TestRingValue(t *testing.T) {
+	tests := []struct {
+		mode  RingMode
+		value uint8
+		want  uint8
+	}{
+		{RingDot, 0, 0x00},
+		{RingDot, 1, 0x01},
+		{RingDot, 64, 0x06},
+		{RingDot, 127, 0x0b},
+		{RingDot, 200, 0x06}, // only 7 bits are used
+		{RingFill, 0, 0x20},
+		{RingFill, 127, 0x2b},
+		{RingSpread, 1, 0x31},
+		{RingSpread, 64, 0x33},
+		{RingSpread, 127, 0x36},
+	}
+	for _, tt := range tests {
+		if got := ringValue(tt.mode, tt.value); got != tt.want {
+			t.Errorf("ringValue(%d, %d) = %#x, want %#x", tt.mode, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMeterLevel(t *testing.T) {
+	tests := []struct {
+		value uint8
+		want  uint8
+	}{
+		{0, 0},
+		{10, 0},
+		{11, 1},
+		{64, 6},
+		{126, 11},
+		{127, 12},
+		{255, 12},
+	}
+	for _, tt := range tests {
+		if got := meterLevel(tt.value); got != tt.want {
+			t.Errorf("meterLevel(%d) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestVPotRingsFlush(t *testing.T) {
+	d := newRecordingDisplay()
+	r := NewVPotRings()
+	r.SetDisplay(d)
+
+	r.SetRing(1, RingFill, 64)
+	r.SetRing(9, RingFill, 64) // no such channel
+	r.SetMeter(2, 127)
+	r.Flush()
+	assertCalls(t, d, "ring 1 0x26", "meters map[2:12]")
+
+	r.Flush()
+	assertCalls(t, d, "meters map[2:12]") // unchanged ring, the meters are always sent
+	r.RefreshMeters()
+	assertCalls(t, d, "meters map[2:12]")
+
+	r.Invalidate()
+	r.Flush()
+	assertCalls(t, d, "ring 1 0x26", "meters map[2:12]")
+
+	r.Clear()
+	r.Flush()
+	assertCalls(t, d, "ring 1 0x0")
+	r.RefreshMeters()
+	assertCalls(t, d)
+
+	d.capabilities = Capabilities{Text: true}
+	r.SetRing(1, RingDot, 1)
+	r.Flush()
+	assertCalls(t, d) // display without controls
+}
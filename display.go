@@ -0,0 +1,416 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awitez/shuttleMidi/devices"
+
+	"github.com/spf13/viper"
+)
+
+// statusRegion is the name of the display cell showing transient states like solos, talkback or the profile name
+const statusRegion = "status"
+
+// lcd is the content of the MCU scribble strips written by ShuttleMidi. Strips never written are left to the DAW
+var lcd = newDisplayLayout()
+
+// leds are the button LEDs of the control surface set by ShuttleMidi. LEDs never set are left to the DAW
+var leds = devices.NewButtonLEDs()
+
+var (
+	// displayQueue writes the display updates asynchronously, so the event loop doesn't wait for the display
+	displayQueue      *devices.QueuedDisplay
+	displayQueueMutex sync.Mutex
+	// displaySetup are the port and the settings displayQueue was created with
+	displaySetup string
+)
+
+// rings are the V-Pot LED rings and channel meters showing volumes
+var rings = devices.NewVPotRings()
+
+// segments are the 7-segment timecode and assignment displays
+var segments = devices.NewSegmentDisplay()
+
+var (
+	// timerSettingsMutex guards the settings used by blinkDisplay, refreshMeters and watchFocus. They run in their own
+	// goroutines, so they read these copies made by updateTimerSettings instead of viper
+	timerSettingsMutex sync.Mutex
+	timerBlinkRate     time.Duration
+	timerUseDisplay    bool
+	timerVolumeMeters  bool
+	timerAutoProfile   bool
+)
+
+// updateTimerSettings copies the settings used by blinkDisplay, refreshMeters and watchFocus. It's called whenever
+// they change
+func updateTimerSettings() {
+	timerSettingsMutex.Lock()
+	defer timerSettingsMutex.Unlock()
+	timerBlinkRate = time.Duration(viper.GetInt("blinkRate")) * time.Millisecond
+	timerUseDisplay = viper.GetBool("useDisplay")
+	timerVolumeMeters = viper.GetBool("volumeMeters")
+	timerAutoProfile = viper.GetBool("autoProfile")
+}
+
+// timerSettings returns the settings copied by updateTimerSettings
+func timerSettings() (blinkRate time.Duration, useDisplay bool, volumeMeters bool) {
+	timerSettingsMutex.Lock()
+	defer timerSettingsMutex.Unlock()
+	return timerBlinkRate, timerUseDisplay, timerVolumeMeters
+}
+
+// newDisplay returns the display of the type 'displayType' connected to the MIDI port device. Without a port (e.g.
+// it wasn't found) nothing is sent to the hardware. With 'tuiOutput' set a hardware display is mirrored to a terminal
+// display
+func newDisplay(device string) devices.Display {
+	kind := viper.GetString("displayType")
+	if kind == devices.DisplayTUI {
+		return tuiDisplay(devices.NullDisplay{})
+	}
+	var display devices.Display = devices.NullDisplay{}
+	if device != "" {
+		var err error
+		display, err = devices.NewDisplay(kind, device, viper.GetString("displaySysexHeader"))
+		if err != nil {
+			slog.Error("display: can't use display", "device", device, "err", err)
+		}
+	}
+	if viper.GetString("tuiOutput") == "" {
+		return display
+	}
+	return devices.MirrorDisplay(display, tuiDisplay(devices.NullDisplay{}))
+}
+
+// tuiDisplay returns the terminal display writing to 'tuiOutput' (default: standard output), fallback if it can't
+// be opened
+func tuiDisplay(fallback devices.Display) devices.Display {
+	display, err := devices.NewTUIDisplay(viper.GetString("tuiOutput"))
+	if err != nil {
+		slog.Error("display: can't open terminal display", "output", viper.GetString("tuiOutput"), "err", err)
+		return fallback
+	}
+	return display
+}
+
+// currentDisplay returns the queue writing to the display set up by updateDisplay
+func currentDisplay() devices.Display {
+	displayQueueMutex.Lock()
+	defer displayQueueMutex.Unlock()
+	if displayQueue == nil {
+		return devices.NullDisplay{}
+	}
+	return displayQueue
+}
+
+// updateDisplay sets up the display connected to the port found by updateDisplayPort, if the port or the display
+// settings changed. Otherwise only the limits 'displayQueueSize' and 'displayRate' are updated. The queue of the
+// previous display is closed once its pending updates are sent. It runs within the event loop
+func updateDisplay() {
+	setup := strings.Join([]string{displayPortName, viper.GetString("displayType"),
+		viper.GetString("displaySysexHeader"), viper.GetString("tuiOutput")}, "\n")
+	displayQueueMutex.Lock()
+	defer displayQueueMutex.Unlock()
+	if displayQueue != nil && setup == displaySetup {
+		displayQueue.SetLimits(viper.GetInt("displayQueueSize"), viper.GetInt("displayRate"))
+		return
+	}
+	if displayQueue != nil {
+		go func(q *devices.QueuedDisplay) {
+			q.Wait(displayDrainTimeout * time.Millisecond)
+			q.Close()
+		}(displayQueue)
+	}
+	displaySetup = setup
+	displayQueue = devices.NewQueuedDisplay(newDisplay(displayPortName), viper.GetInt("displayQueueSize"),
+		viper.GetInt("displayRate"))
+}
+
+// drainDisplay waits until the pending display updates are sent, e.g. before quitting
+func drainDisplay() {
+	displayQueueMutex.Lock()
+	q := displayQueue
+	displayQueueMutex.Unlock()
+	if q != nil {
+		q.Wait(displayDrainTimeout * time.Millisecond)
+	}
+}
+
+// newDisplayLayout returns the framebuffer with the named regions of the display
+func newDisplayLayout() *devices.Framebuffer {
+	fb := devices.NewFramebuffer()
+	fb.DefineRegion(statusRegion, devices.CellRegion(profileLCDchannel, lowerRow))
+	return fb
+}
+
+// showCell writes text into the display cell of the channel (1-8) in the row (upperRow or lowerRow) and sends the
+// changed characters to the display
+func showCell(channel uint8, row uint8, text string) {
+	if channel == 0 || !viper.GetBool("useDisplay") {
+		return
+	}
+	if currentPage() != monitorPage {
+		showPage(false)
+		return
+	}
+	lcd.SetDisplay(currentDisplay())
+	lcd.WriteRegion(devices.CellRegion(channel, row), text)
+	lcd.Flush()
+}
+
+// showStatus writes text into the status cell and sends the changed characters to the display
+func showStatus(text string) {
+	if !viper.GetBool("useDisplay") {
+		return
+	}
+	if currentPage() != monitorPage {
+		showPage(false)
+		return
+	}
+	lcd.SetDisplay(currentDisplay())
+	lcd.Write(statusRegion, text)
+	lcd.Flush()
+}
+
+// clearDisplay blanks all strips written by ShuttleMidi and sets the strip colors to white
+func clearDisplay(display devices.Display) {
+	lcd.SetDisplay(display)
+	lcd.Clear()
+	for i := uint8(1); i <= devices.StripCount; i++ {
+		lcd.SetColor(i, white)
+	}
+	lcd.Flush()
+	leds.SetDisplay(display)
+	leds.Clear()
+	leds.Flush()
+	rings.SetDisplay(display)
+	rings.Clear()
+	rings.Flush()
+	segments.SetDisplay(display)
+	segments.Clear()
+	segments.Flush()
+}
+
+// setSegmentDisplay writes the main volume in dB or the name of the active profile to the timecode display and the
+// speaker set (ST stereo, SU surround) or the profile to the assignment display, as selected by 'timecodeDisplay'
+// and 'assignmentDisplay'. Volume and speaker set are only shown for monitor profiles
+func setSegmentDisplay() {
+	switch viper.GetString("timecodeDisplay") {
+	case "volume":
+		text := ""
+		if activeProfile.monitor {
+			text = strings.TrimSpace(mainVolTable[mainOutVolume()]) + " dB"
+		}
+		segments.WriteTimecode(text)
+	case "profile":
+		segments.WriteTimecode(activeProfile.name)
+	}
+	switch viper.GetString("assignmentDisplay") {
+	case "speakers":
+		text := ""
+		if activeProfile.monitor {
+			text = "ST"
+			if activeProfile.buttons[stereoSurroundButton].state {
+				text = "SU"
+			}
+		}
+		segments.WriteAssignment(text)
+	case "profile":
+		segments.WriteAssignment(activeProfile.name)
+	}
+}
+
+// showSegmentDisplay writes the 7-segment displays like setSegmentDisplay and sends the changed digits
+func showSegmentDisplay() {
+	if !viper.GetBool("useDisplay") {
+		return
+	}
+	segments.SetDisplay(currentDisplay())
+	setSegmentDisplay()
+	segments.Flush()
+}
+
+// setVolumeRing writes a volume (0-127) to the V-Pot ring of the channel (1-8) in the ring mode named by mode and, if
+// 'volumeMeters' is set, to the channel meter. Without a valid mode nothing is shown
+func setVolumeRing(channel uint8, mode string, volume uint8) {
+	ringMode, ok := ringModes[mode]
+	if channel == 0 || !ok {
+		return
+	}
+	rings.SetRing(channel, ringMode, volume)
+	if viper.GetBool("volumeMeters") {
+		rings.SetMeter(channel, volume)
+	}
+}
+
+// showVolumeRing writes a volume to the V-Pot ring of the channel like setVolumeRing and sends it to the display
+func showVolumeRing(channel uint8, mode string, volume uint8) {
+	if !viper.GetBool("useDisplay") {
+		return
+	}
+	rings.SetDisplay(currentDisplay())
+	setVolumeRing(channel, mode, volume)
+	rings.Flush()
+}
+
+// refreshMeters keeps the channel meters up by sending them every meterRefreshInterval until quitCh is closed
+func refreshMeters(quitCh chan struct{}) {
+	tick := time.NewTicker(meterRefreshInterval * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-quitCh:
+			return
+		case <-tick.C:
+			if _, useDisplay, volumeMeters := timerSettings(); useDisplay && volumeMeters {
+				rings.RefreshMeters()
+			}
+		}
+	}
+}
+
+// usedStrips returns the channels (1-8) of the strips used by the active profile and the cues in ascending order
+func usedStrips() []uint8 {
+	used := [devices.StripCount + 1]bool{}
+	use := func(channel uint8) {
+		if channel >= 1 && channel <= devices.StripCount {
+			used[channel] = true
+		}
+	}
+	for _, b := range activeProfile.buttons {
+		use(b.LCDchannel)
+	}
+	for _, c := range cues {
+		use(c.LCDchannel)
+	}
+	use(profileLCDchannel)
+
+	strips := []uint8{}
+	for channel := uint8(1); channel <= devices.StripCount; channel++ {
+		if used[channel] {
+			strips = append(strips, channel)
+		}
+	}
+	return strips
+}
+
+// stripColors returns the colors of the strips. Strips used by the active profile get the color 'stripColor', the
+// 'colorOff' of a button that is off and the 'colorOn' of a button that is on override it, in this order. Unused
+// strips are switched off
+func stripColors() [devices.StripCount]string {
+	var colors [devices.StripCount]string
+	for _, channel := range usedStrips() {
+		colors[channel-1] = colorNames[viper.GetString("stripColor")]
+	}
+
+	set := func(channel uint8, name string) {
+		if color, ok := colorNames[name]; ok && channel >= 1 && channel <= devices.StripCount {
+			colors[channel-1] = color
+		}
+	}
+	for _, b := range activeProfile.buttons {
+		if !b.state {
+			set(b.LCDchannel, b.colorOff)
+		}
+	}
+	for _, b := range activeProfile.buttons {
+		if b.state {
+			set(b.LCDchannel, b.colorOn)
+		}
+	}
+	return colors
+}
+
+// setIndicators writes the strip colors, blinking cells, button LEDs and 7-segment displays of the current state into
+// the framebuffer, the LEDs and the segments. A cell or strip blinks while any of its buttons with 'blink' set is on.
+// An LED shared by several buttons shows 'ledOn' if any of them is on
+func setIndicators() {
+	ledStates := map[uint8]devices.LEDMode{}
+	for _, b := range activeProfile.buttons {
+		if b.hasLED && !b.state {
+			ledStates[b.led] = ledMode(b.ledOff, devices.LEDOff)
+		}
+	}
+	for _, b := range activeProfile.buttons {
+		if b.hasLED && b.state {
+			ledStates[b.led] = ledMode(b.ledOn, devices.LEDOn)
+		}
+	}
+	leds.Clear() // LEDs of a previous profile
+	for note, mode := range ledStates {
+		leds.Set(note, mode)
+	}
+
+	setSegmentDisplay()
+	for i, v := range stripColors() {
+		lcd.SetColor(uint8(i+1), v)
+	}
+	var text [devices.StripCount][2]bool
+	onMonitor := currentPage() == monitorPage // other pages don't show the button texts
+	var color [devices.StripCount]bool
+	for _, b := range activeProfile.buttons {
+		if !b.state || b.LCDchannel < 1 || b.LCDchannel > devices.StripCount {
+			continue
+		}
+		row := 0
+		if b.LCDrow == lowerRow {
+			row = 1
+		}
+		text[b.LCDchannel-1][row] = text[b.LCDchannel-1][row] || (onMonitor && (b.blink == blinkText || b.blink == blinkBoth))
+		color[b.LCDchannel-1] = color[b.LCDchannel-1] || b.blink == blinkColor || b.blink == blinkBoth
+	}
+	for i := range text {
+		lcd.SetBlink(devices.CellRegion(uint8(i+1), upperRow), text[i][0])
+		lcd.SetBlink(devices.CellRegion(uint8(i+1), lowerRow), text[i][1])
+		lcd.SetColorBlink(uint8(i+1), color[i])
+	}
+}
+
+// ledMode returns the LED mode of the config value name, def if it is empty or unknown
+func ledMode(name string, def devices.LEDMode) devices.LEDMode {
+	if mode, ok := ledModes[name]; ok {
+		return mode
+	}
+	return def
+}
+
+// showIndicators sends the strip colors, blinking cells, button LEDs and 7-segment displays to the display if they
+// changed
+func showIndicators() {
+	if !viper.GetBool("useDisplay") {
+		return
+	}
+	lcd.SetDisplay(currentDisplay())
+	leds.SetDisplay(currentDisplay())
+	segments.SetDisplay(currentDisplay())
+	setIndicators()
+	lcd.Flush()
+	leds.Flush()
+	segments.Flush()
+}
+
+// blinkDisplay switches the blink phase of the display every 'blinkRate' milliseconds until quitCh is closed. With
+// a rate of 0 blinking cells and strips are shown steadily. Only the framebuffer's blink phase is changed, so blinking
+// doesn't interfere with other updates of the display
+func blinkDisplay(quitCh chan struct{}) {
+	visible := true
+	for {
+		rate, useDisplay, _ := timerSettings()
+		wait := rate
+		if rate <= 0 {
+			wait = time.Second
+		}
+		select {
+		case <-quitCh:
+			return
+		case <-time.After(wait):
+		}
+		visible = rate <= 0 || !visible
+		lcd.SetBlinkPhase(visible)
+		if useDisplay {
+			lcd.Flush()
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/awitez/shuttleMidi/devices"
+
+	"github.com/spf13/viper"
+)
+
+// names of the display pages as used by the config key 'displayPages'
+const (
+	monitorPage     = "Monitor"
+	cuesPage        = "Cues"
+	snapshotsPage   = "Snapshots"
+	diagnosticsPage = "Diagnostics"
+)
+
+var (
+	// pageNames contains all display pages
+	pageNames = []string{monitorPage, cuesPage, snapshotsPage, diagnosticsPage}
+	// activePage is the index of the page shown in 'displayPages'
+	activePage int
+)
+
+// nextPageButton returns the button definition used for a button mapped to the nextPage action
+func nextPageButton() button {
+	return button{
+		latch:  false,
+		action: actionNextPage,
+	}
+}
+
+// displayPages returns the pages of the config key 'displayPages' in the order they are flipped through. Without
+// pages only the Monitor page is used
+func displayPages() []string {
+	pages := viper.GetStringSlice("displayPages")
+	if len(pages) == 0 {
+		return []string{monitorPage}
+	}
+	return pages
+}
+
+// currentPage returns the name of the page shown on the display
+func currentPage() string {
+	pages := displayPages()
+	return pages[activePage%len(pages)]
+}
+
+// nextDisplayPage flips to the next display page, after the last one the first page is shown again
+func nextDisplayPage() {
+	activePage = (activePage + 1) % len(displayPages())
+	slog.Info("display page selected", "page", currentPage())
+	showPage(true)
+	showIndicators()
+}
+
+// showPage writes the layout of the current page and sends the changed characters to the display. full also writes
+// the cells of the Monitor page shared by several buttons, e.g. after flipping the page
+func showPage(full bool) {
+	if !viper.GetBool("useDisplay") {
+		return
+	}
+	lcd.SetDisplay(currentDisplay())
+	writePage(full)
+	lcd.Flush()
+}
+
+// writePage writes the layout of the current page into the framebuffer
+func writePage(full bool) {
+	switch currentPage() {
+	case cuesPage:
+		writeCuesPage()
+	case snapshotsPage:
+		writeSnapshotsPage()
+	case diagnosticsPage:
+		writeDiagnosticsPage()
+	default:
+		writeMonitorPage(full)
+	}
+}
+
+// writeStrips writes the texts into the upper and then the lower row of the strips used by the active profile.
+// Cells without text are blanked
+func writeStrips(upper []string, lower []string) {
+	for i, channel := range usedStrips() {
+		for row, texts := range map[uint8][]string{upperRow: upper, lowerRow: lower} {
+			text := ""
+			if i < len(texts) {
+				text = texts[i]
+			}
+			lcd.WriteRegion(devices.CellRegion(channel, row), text)
+		}
+	}
+}
+
+// writeMonitorPage writes the button states, the main volume and the cue volumes. Cells shared by several buttons
+// keep their current text unless full is set, then they show the first button that is on
+func writeMonitorPage(full bool) {
+	if full {
+		for _, channel := range usedStrips() {
+			lcd.WriteRegion(devices.CellRegion(channel, upperRow), "")
+			lcd.WriteRegion(devices.CellRegion(channel, lowerRow), "")
+		}
+	}
+	shared := map[[2]uint8]bool{}
+	for i := range activeProfile.buttons {
+		b := activeProfile.buttons[i]
+		if !b.latch || b.action != actionNone || b.LCDchannel == 0 {
+			continue
+		}
+		if sharedCell(b.LCDchannel, b.LCDrow) {
+			if full && b.state && !shared[[2]uint8{b.LCDchannel, b.LCDrow}] {
+				lcd.WriteRegion(devices.CellRegion(b.LCDchannel, b.LCDrow), b.msgOn)
+				shared[[2]uint8{b.LCDchannel, b.LCDrow}] = true
+			}
+			continue
+		}
+		text := b.msgOff
+		if b.state {
+			text = b.msgOn
+		}
+		lcd.WriteRegion(devices.CellRegion(b.LCDchannel, b.LCDrow), text)
+	}
+	if activeProfile.monitor {
+		lcd.WriteRegion(devices.CellRegion(activeProfile.buttons[LRbutton].LCDchannel, lowerRow), mainVolTable[mainOutVolume()])
+	}
+	for i := range cues {
+		if cues[i].LCDchannel != 0 {
+			lcd.WriteRegion(devices.CellRegion(cues[i].LCDchannel, lowerRow), headPhoneVolTable[uint8(cues[i].volume)])
+		}
+	}
+}
+
+// writeCuesPage writes the names of the cues into the upper row and their volumes into the lower row. The cue
+// controlled by the dial is marked by '>'
+func writeCuesPage() {
+	upper := []string{}
+	lower := []string{}
+	for i, c := range cues {
+		name := c.name
+		if i == dialCue() {
+			name = ">" + name
+		}
+		upper = append(upper, fmt.Sprintf("%-7.7s", name))
+		lower = append(lower, headPhoneVolTable[uint8(c.volume)])
+	}
+	writeStrips(upper, lower)
+}
+
+// writeSnapshotsPage writes the names of the snapshots, first into the upper row, then into the lower row
+func writeSnapshotsPage() {
+	names := []string{}
+	for _, v := range snapshots {
+		names = append(names, fmt.Sprintf("%-7.7s", v.name))
+	}
+	strips := len(usedStrips())
+	writeStrips(names[:min(strips, len(names))], names[min(strips, len(names)):])
+}
+
+// writeDiagnosticsPage writes the connection state of the MIDI ports, the active profile and the config version
+func writeDiagnosticsPage() {
+	state := func(ok bool) string {
+		if ok {
+			return "  ok   "
+		}
+		return " lost  "
+	}
+	writeStrips(
+		[]string{"Control", "Display", "Profile", "Config "},
+		[]string{state(controlConnected), state(displayPortFound()), fmt.Sprintf("%-7.7s", activeProfile.name),
+			fmt.Sprintf("  v%-4d", viper.GetInt("configVersion"))},
+	)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awitez/shuttleMidi/devices"
+	"github.com/spf13/viper"
+)
+
+var updateGolden = flag.Bool("update", false, "write the golden files of testdata instead of comparing them")
+
+// assertGolden fails if text differs from the golden file of testdata
+func assertGolden(t *testing.T, golden string, text string) {
+	t.Helper()
+	file := filepath.Join("testdata", golden)
+	if *updateGolden {
+		if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != string(want) {
+		t.Errorf("display differs from %s:\n%s\nwant:\n%s", file, text, want)
+	}
+}
+
+func TestRefreshDisplaySnapshot(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Reset()
+		updateTimerSettings()
+	})
+	profiles, cues = nil, nil // no runtime state kept by loadConfig
+	lcd, leds, rings, segments = newDisplayLayout(), devices.NewButtonLEDs(), devices.NewVPotRings(),
+		devices.NewSegmentDisplay()
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	if err := loadBuiltinConfig(); err != nil {
+		t.Fatal(err)
+	}
+	tui := devices.NewTUIWriter(nil)
+
+	refreshDisplay(tui)
+	assertGolden(t, "display.monitor.txt", tui.Snapshot())
+
+	viper.Set("volumeMeters", true)
+	activeProfile.buttons[headPhoneButton].state = true
+	activeProfile.buttons[dimButton].state = true
+	refreshDisplay(tui)
+	assertGolden(t, "display.headphones.txt", tui.Snapshot())
+
+	viper.Set("useDisplay", false)
+	clearDisplay(tui)
+	refreshDisplay(tui) // nothing is written without 'useDisplay'
+	assertGolden(t, "display.cleared.txt", tui.Snapshot())
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var errNoActiveWindow = errors.New("no active window")
+
+// focusSource reports the window class (or application name) of the currently focused window. Implementations exist
+// for X11 and macOS, others can be added for further window systems
+type focusSource interface {
+	activeWindowClass() (string, error)
+}
+
+// x11FocusSource reads the class of the window referenced by _NET_ACTIVE_WINDOW of the root window using 'xprop'.
+// It also works for XWayland windows
+type x11FocusSource struct{}
+
+func (x11FocusSource) activeWindowClass() (string, error) {
+	out, err := exec.Command("xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if err != nil {
+		return "", err
+	}
+	// _NET_ACTIVE_WINDOW(WINDOW): window id # 0x3a00007
+	_, id, found := strings.Cut(strings.TrimSpace(string(out)), "# ")
+	if !found || id == "0x0" {
+		return "", errNoActiveWindow
+	}
+
+	out, err = exec.Command("xprop", "-id", id, "WM_CLASS").Output()
+	if err != nil {
+		return "", err
+	}
+	// WM_CLASS(STRING) = "reaper", "REAPER"
+	_, values, found := strings.Cut(string(out), "=")
+	if !found {
+		return "", errNoActiveWindow
+	}
+	parts := strings.Split(values, ",")
+	return strings.Trim(strings.TrimSpace(parts[len(parts)-1]), "\""), nil
+}
+
+// macFocusSource returns the name of the frontmost application using 'osascript'
+type macFocusSource struct{}
+
+func (macFocusSource) activeWindowClass() (string, error) {
+	out, err := exec.Command("osascript", "-e",
+		"tell application \"System Events\" to get name of first application process whose frontmost is true").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// newFocusSource returns the focus source configured by 'focusBackend' ("auto", "x11" or "macos")
+func newFocusSource() focusSource {
+	switch viper.GetString("focusBackend") {
+	case "x11":
+		return x11FocusSource{}
+	case "macos":
+		return macFocusSource{}
+	}
+	if runtime.GOOS == "darwin" {
+		return macFocusSource{}
+	}
+	return x11FocusSource{}
+}
+
+// focusRule selects a profile if the window class of the focused window matches the regular expression
+type focusRule struct {
+	Match   string `mapstructure:"match"`
+	Profile string `mapstructure:"profile"`
+}
+
+// matchFocusRule returns the profile of the first rule matching the window class (case insensitive)
+func matchFocusRule(rules []focusRule, windowClass string) (string, bool) {
+	for _, v := range rules {
+		re, err := regexp.Compile("(?i)" + v.Match)
+		if err != nil {
+			slog.Error("config: invalid focusRules expression", "match", v.Match, "err", err)
+			continue
+		}
+		if re.MatchString(windowClass) {
+			return v.Profile, true
+		}
+	}
+	return "", false
+}
+
+// autoProfileEnabled reports if 'autoProfile' is set, using the copy made by updateTimerSettings
+func autoProfileEnabled() bool {
+	timerSettingsMutex.Lock()
+	defer timerSettingsMutex.Unlock()
+	return timerAutoProfile
+}
+
+// applyFocusRules switches to the profile of the first rule in 'focusRules' matching the window class. Nothing
+// happens if no rule matches. Failures to open the MIDI device are only logged. It runs within the event loop
+func applyFocusRules(windowClass string) {
+	var rules []focusRule
+	if err := viper.UnmarshalKey("focusRules", &rules); err != nil {
+		slog.Error("config: can't read focusRules", "err", err)
+		return
+	}
+	name, ok := matchFocusRule(rules, windowClass)
+	if !ok || name == activeProfile.name {
+		return
+	}
+	for i, v := range profiles {
+		if v.name == name {
+			slog.Info("focus changed", "window", windowClass, "profile", name)
+			switchProfile(i, false, false)
+			return
+		}
+	}
+}
+
+// watchFocus polls the focus source while 'autoProfile' is set and lets the event loop call apply (applyFocusRules)
+// with the window class whenever the focused window changes. The goroutine is stopped by closing quitCh
+func watchFocus(source focusSource, apply func(windowClass string), quitCh chan struct{}) {
+	tick := time.NewTicker(focusPollInterval * time.Millisecond)
+	defer tick.Stop()
+
+	lastClass := ""
+	for {
+		select {
+		case <-quitCh:
+			return
+		case <-tick.C:
+			if !autoProfileEnabled() {
+				lastClass = ""
+				continue
+			}
+			windowClass, err := source.activeWindowClass()
+			if err != nil || windowClass == lastClass {
+				continue
+			}
+			if requestEvent(func() { apply(windowClass) }) { // retried on the next tick otherwise
+				lastClass = windowClass
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestMatchFocusRule(t *testing.T) {
+	rules := []focusRule{
+		{Match: "^reaper$", Profile: "Reaper"},
+		{Match: "([", Profile: "Invalid"},
+		{Match: "firefox|chrom", Profile: "Browser"},
+		{Match: "", Profile: "Default"},
+	}
+	tests := []struct {
+		name        string
+		rules       []focusRule
+		windowClass string
+		want        string
+		wantOK      bool
+	}{
+		{"exact match", rules, "reaper", "Reaper", true},
+		{"case insensitive", rules, "REAPER", "Reaper", true},
+		{"alternative", rules, "Chromium", "Browser", true},
+		{"invalid expression skipped", rules, "([", "Default", true},
+		{"catch-all rule", rules, "xterm", "Default", true},
+		{"first match wins", []focusRule{{Match: "a", Profile: "A"}, {Match: "ab", Profile: "AB"}}, "ab", "A", true},
+		{"no match", rules[:3], "xterm", "", false},
+		{"no rules", nil, "reaper", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchFocusRule(tt.rules, tt.windowClass)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("matchFocusRule(%q) = %q, %v, want %q, %v", tt.windowClass, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// fakeFocusSource reports the window class set by the test
+type fakeFocusSource struct {
+	mutex       sync.Mutex
+	windowClass string
+	err         error
+}
+
+func (s *fakeFocusSource) activeWindowClass() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.windowClass, s.err
+}
+
+func (s *fakeFocusSource) set(windowClass string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.windowClass, s.err = windowClass, err
+}
+
+func TestWatchFocus(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Reset()
+		updateTimerSettings()
+	})
+	viper.Set("autoProfile", true)
+	updateTimerSettings()
+
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	go func() { // the event loop
+		for {
+			select {
+			case <-quitCh:
+				return
+			case f := <-requestCh:
+				f()
+			}
+		}
+	}()
+
+	source := &fakeFocusSource{windowClass: "REAPER"}
+	applied := make(chan string, 10)
+	go watchFocus(source, func(windowClass string) { applied <- windowClass }, quitCh)
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-applied:
+			if got != want {
+				t.Errorf("applied %q, want %q", got, want)
+			}
+		case <-time.After(4 * focusPollInterval * time.Millisecond):
+			t.Errorf("%q not applied", want)
+		}
+	}
+	expectNothing := func() {
+		t.Helper()
+		select {
+		case got := <-applied:
+			t.Errorf("unexpected %q applied", got)
+		case <-time.After(3 * focusPollInterval * time.Millisecond):
+		}
+	}
+
+	expect("REAPER")
+	expectNothing() // unchanged focus
+
+	source.set("Firefox", errNoActiveWindow)
+	expectNothing()
+	source.set("Firefox", nil)
+	expect("Firefox")
+
+	viper.Set("autoProfile", false)
+	updateTimerSettings()
+	source.set("REAPER", nil)
+	expectNothing()
+
+	viper.Set("autoProfile", true)
+	updateTimerSettings()
+	expect("REAPER")
+}
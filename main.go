@@ -3,7 +3,11 @@
 package main
 
 import (
-	"strings"
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/awitez/shuttleMidi/devices"
@@ -18,72 +22,112 @@ import (
 
 // quitCh is the channel used to stop the goroutine handling the ShuttlePro events
 var (
-	quitCh   chan struct{}
+	quitCh chan struct{}
+	// mControl is the control MIDI device, only used by the event loop (readShuttle)
 	mControl midiController
+	// controlConnected reports if mControl was opened successfully
+	controlConnected bool
+	// requestCh passes functions to readShuttle, which runs them within the event loop
+	requestCh = make(chan func())
 )
 
-// initSettings initializes the settings engine Viper. If it doesn't exist it is automatically created using the defaults
+// requestEvent runs f within the event loop. The event loop owns the control MIDI device, the profiles and the
+// settings, so tray menu items and watchers change them only this way and never concurrently. It returns false if
+// the event loop doesn't accept the request within requestTimeout, e.g. while quitting
+func requestEvent(f func()) bool {
+	select {
+	case requestCh <- f:
+		return true
+	case <-time.After(requestTimeout * time.Millisecond):
+		return false
+	}
+}
+
+// initSettings initializes the settings engine Viper with the config file and merges its override files on top of it.
+// If the config file doesn't exist at the default location it is automatically created using the defaults
 func initSettings() error {
 	for k, v := range configDefaults {
 		viper.SetDefault(k, v)
 	}
-	viper.SetConfigName("shuttleMidi")
 	viper.SetConfigType("yaml")
-	viper.AddConfigPath("$HOME/.config/")
-
-	if err := viper.ReadInConfig(); err != nil { // can't read
-		slog.Error("viper: cannot read configfile", err)
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok { // file not found
-			slog.Error("viper: config file not found", err)
-			if err = viper.SafeWriteConfig(); err != nil { // can't write
-				slog.Error("viper: can't save config", err)
-				return err
-			}
-		} else { // file found but a different error
+	configFile = resolveConfigFile()
+	viper.SetConfigFile(configFile)
+
+	if _, err := os.Stat(configFile); errors.Is(err, fs.ErrNotExist) && configFile == defaultConfigFile() {
+		slog.Info("viper: config file not found", "file", configFile)
+		if err := os.MkdirAll(filepath.Dir(configFile), 0o755); err != nil {
+			slog.Error("viper: can't save config", "err", err)
+			return err
+		}
+		if err = viper.SafeWriteConfigAs(configFile); err != nil { // can't write
+			slog.Error("viper: can't save config", "err", err)
 			return err
 		}
-		slog.Info("viper: config file was written")
+		slog.Info("viper: config file was written", "file", configFile)
+	}
+
+	if err := migrateConfigFiles(configFile); err != nil { // still migrated in memory when read
+		slog.Error("config: can't migrate config file", "file", configFile, "err", err)
+	}
+	sources, err := readConfigSources(configFile)
+	if err != nil {
+		slog.Error("viper: cannot read configfile", "err", err)
+		return err
+	}
+	if err := applySettings(sources); err != nil {
+		slog.Error("viper: cannot read configfile", "err", err)
+		return err
 	}
+	slog.Info("config: loaded", "files", sourceFiles(sources))
+	rememberConfig()
 	return nil
 }
 
-// refreshDisplay transmits all values to the display device (Mackie Control)
-func refreshDisplay(device string) { // TODO:  make solo state blink
+// refreshDisplay transmits all values to the display device (Mackie Control). The scribble strips show the current
+// display page, on the Monitor page cells shared by several buttons (e.g. the solos) keep their current text
+func refreshDisplay(display devices.Display) {
 	if !viper.GetBool("useDisplay") {
 		return
 	}
-	devices.InitColor(device, yellow)
-
-	textUpperRow := ""
-	for i := range csPro {
-		if csPro[i].latch {
-			if csPro[i].state { // button is 'on'
-				if (csPro[i].LCDchannel != 0) && (csPro[i].LCDrow == upperRow) {
-					textUpperRow = textUpperRow + csPro[i].msgOn
-				}
-			} else { // button is 'off'
-				if (csPro[i].LCDchannel != 0) && (csPro[i].LCDrow == upperRow) {
-					textUpperRow = textUpperRow + csPro[i].msgOff
-				}
-			}
+	lcd.SetDisplay(display)
+	lcd.Invalidate()
+	leds.SetDisplay(display)
+	leds.Invalidate()
+	segments.SetDisplay(display)
+	segments.Invalidate()
+	setIndicators()
+	leds.Flush()
+	segments.Flush()
+	rings.SetDisplay(display)
+	rings.Invalidate()
+
+	writePage(false)
+	if activeProfile.monitor {
+		setVolumeRing(activeProfile.buttons[LRbutton].LCDchannel, viper.GetString("mainRing"), mainOutVolume())
+	}
+	for i := range cues {
+		if cues[i].LCDchannel != 0 {
+			setVolumeRing(cues[i].LCDchannel, cues[i].ring, uint8(cues[i].volume))
 		}
 	}
+	lcd.Flush()
+	rings.Flush()
+}
 
-	textLowerRow := mainVolTable[uint8(mainVolume)]
-	if csPro[LFEbutton].state {
-		textLowerRow = textLowerRow + csPro[LFEbutton].msgOn
-	} else {
-		textLowerRow = textLowerRow + csPro[LFEbutton].msgOff
+// sharedCell reports if several buttons of the active profile use the display cell
+func sharedCell(channel uint8, row uint8) bool {
+	count := 0
+	for _, b := range activeProfile.buttons {
+		if b.LCDchannel == channel && b.LCDrow == row {
+			count++
+		}
 	}
-	textLowerRow = textLowerRow + headPhoneVolTable[uint8(headPhoneVolume)]
-
-	devices.DisplayLCDtext(device, csPro[LRbutton].LCDchannel, upperRow, textUpperRow)
-	time.Sleep(displayRowsDelay * time.Millisecond) // wait a little bit, MCU device might be 'overwhelmed'
-	devices.DisplayLCDtext(device, csPro[LRbutton].LCDchannel, lowerRow, textLowerRow)
+	return count > 1
 }
 
 // onReady is called by systray once the system tray menu can be created. It inializes the menu and opens the ShuttlePro device
 func onReady() {
+	quitCh = make(chan struct{})
 	shuttlePro, err := devices.NewShuttleProV2()
 	if err != nil {
 		if err == devices.ErrShuttleProV2DeviceNotFound {
@@ -95,72 +139,47 @@ func onReady() {
 		systray.Quit()
 	}
 
-	MIDIdevices, err := getMIDIDevices(nil)
-	if err != nil {
-		slog.Error("devices: can't get MIDIdevices", err)
-	}
-
-	controlName := viper.GetString("controlMidiDevice")
-	displayName := viper.GetString("displayMidiDevice")
 	menuExit := make(chan struct{})
 
 	// build systray menues
 	systray.SetTemplateIcon(icon.Data, icon.Data)
 	systray.SetTooltip(applicationName)
 
-	mControlMIDIMenu := systray.AddMenuItem("Control MIDI device", "")
-	mDisplayMIDIMenu := systray.AddMenuItem("Display MIDI device", "")
-
-	mControlMIDISubItems := make([]*systray.MenuItem, 0, len(MIDIdevices))
-	mDisplayMIDISubItems := make([]*systray.MenuItem, 0, len(MIDIdevices))
+	mPortStatus := systray.AddMenuItem("", "")
+	mPortStatus.Disable()
+	mControlMIDIMenu = systray.AddMenuItem("Control MIDI device", "")
+	mDisplayMIDIMenu = systray.AddMenuItem("Display MIDI device", "")
+	if ports, ok := midiPorts(nil); ok { // the event loop isn't running yet
+		updateMIDIMenus(ports, menuExit)
+		updateDisplayPort(ports)
+	}
+	updateDisplay()
 
 	systray.AddSeparator()
 	mReconnectShuttle := systray.AddMenuItem("Reconnect Shuttle", "")
+	mRescanMIDI := systray.AddMenuItem("Rescan MIDI devices", "")
 	mRefreshDisplayItem := systray.AddMenuItem("Refresh Display", "")
 	mUseDisplayItem := systray.AddMenuItemCheckbox("Use Display", "", viper.GetBool("useDisplay"))
 
 	systray.AddSeparator()
 	mUseMediaKeys := systray.AddMenuItemCheckbox("Control Music.app", "", viper.GetBool("useMediaKeys"))
 
+	systray.AddSeparator()
+	mProfilesMenu := systray.AddMenuItem("Profiles", "")
+	buildProfileMenu(mProfilesMenu, menuExit)
+	mSnapshotsMenu := systray.AddMenuItem("Snapshots", "")
+	mSaveSnapshot := mSnapshotsMenu.AddSubMenuItem("Save current state...", "")
+	snapshotItems := map[string]bool{}
+	for _, v := range snapshots {
+		addSnapshotMenuItem(mSnapshotsMenu, v.name, menuExit)
+		snapshotItems[v.name] = true
+	}
+
 	systray.AddSeparator()
 	mQuitItem := systray.AddMenuItem("Quit", "")
 	mQuitItem.Enable()
 
-	for _, v := range MIDIdevices {
-		mControlMIDISubItem := mControlMIDIMenu.AddSubMenuItemCheckbox(v, "", strings.Contains(v, controlName))
-		mDisplayMIDISubItem := mDisplayMIDIMenu.AddSubMenuItemCheckbox(v, "", strings.Contains(v, displayName))
-
-		mControlMIDISubItems = append(mControlMIDISubItems, mControlMIDISubItem)
-		mDisplayMIDISubItems = append(mDisplayMIDISubItems, mDisplayMIDISubItem)
-		title := v
-
-		// a go routine for every sub menu item (MIDI device)
-		go func() {
-			for {
-				select {
-				case <-mControlMIDISubItem.ClickedCh:
-					for _, v := range mControlMIDISubItems {
-						v.Uncheck()
-					}
-					mControlMIDISubItem.Check()
-					viper.Set("controlMidiDevice", title)
-					viper.WriteConfig()
-					startListeners(title, shuttlePro)
-				case <-mDisplayMIDISubItem.ClickedCh:
-					for _, v := range mDisplayMIDISubItems {
-						v.Uncheck()
-					}
-					mDisplayMIDISubItem.Check()
-					viper.Set("displayMidiDevice", title)
-					viper.WriteConfig()
-				case <-menuExit:
-					return
-				}
-			}
-		}()
-	}
-
-	go func() { // loop for menu items: 'Refresh Display' + 'Use Display' + 'Control Music.app'
+	go func() { // loop for menu items: 'Rescan MIDI devices' + 'Refresh Display' + 'Use Display' + 'Control Music.app' + 'Save current state'
 		for {
 			select {
 			case <-mReconnectShuttle.ClickedCh:
@@ -169,310 +188,458 @@ func onReady() {
 				if err != nil {
 					dlgs.Error(applicationName, err.Error())
 				}
+			case <-mRescanMIDI.ClickedCh:
+				rescanMIDIPorts(menuExit)
 			case <-mRefreshDisplayItem.ClickedCh:
-				refreshDisplay(viper.GetString("displayMidiDevice"))
+				requestEvent(func() { refreshDisplay(currentDisplay()) })
 			case <-mUseDisplayItem.ClickedCh:
-				if mUseDisplayItem.Checked() {
-					mUseDisplayItem.Uncheck()
-					viper.Set("useDisplay", false)
-					viper.WriteConfig()
-					devices.ClearDisplay(viper.GetString("displayMidiDevice"), csPro[LRbutton].LCDchannel)
-				} else {
-					mUseDisplayItem.Check()
-					viper.Set("useDisplay", true)
-					viper.WriteConfig()
-					refreshDisplay(viper.GetString("displayMidiDevice"))
-				}
+				requestEvent(func() {
+					if mUseDisplayItem.Checked() {
+						mUseDisplayItem.Uncheck()
+						viper.Set("useDisplay", false)
+						writeConfig("useDisplay")
+						updateTimerSettings()
+						clearDisplay(currentDisplay())
+					} else {
+						mUseDisplayItem.Check()
+						viper.Set("useDisplay", true)
+						writeConfig("useDisplay")
+						updateTimerSettings()
+						refreshDisplay(currentDisplay())
+					}
+				})
 			case <-mUseMediaKeys.ClickedCh:
-				if mUseMediaKeys.Checked() {
-					mUseMediaKeys.Uncheck()
-					viper.Set("useMediaKeys", false)
-					viper.WriteConfig()
-				} else {
-					mUseMediaKeys.Check()
-					viper.Set("useMediaKeys", true)
-					viper.WriteConfig()
+				requestEvent(func() {
+					if mUseMediaKeys.Checked() {
+						mUseMediaKeys.Uncheck()
+						viper.Set("useMediaKeys", false)
+						writeConfig("useMediaKeys")
+					} else {
+						mUseMediaKeys.Check()
+						viper.Set("useMediaKeys", true)
+						writeConfig("useMediaKeys")
+					}
+				})
+			case <-mSaveSnapshot.ClickedCh:
+				name, ok, err := dlgs.Entry(applicationName, "Name of the snapshot:", "")
+				if err != nil || !ok {
+					break
 				}
+				requestEvent(func() {
+					isNew := findSnapshot(name) == nil
+					if err := saveSnapshot(name); err != nil {
+						go dlgs.Error(applicationName, "Unable to save snapshot.\n"+err.Error())
+						return
+					}
+					if isNew {
+						addSnapshotMenuItem(mSnapshotsMenu, name, menuExit)
+						snapshotItems[name] = true
+					}
+				})
 			case <-menuExit:
 				return
 			}
 		}
 	}()
 
+	// trayUpdate is called after the config file was reloaded
+	trayUpdate = func() {
+		setChecked(mUseDisplayItem, viper.GetBool("useDisplay"))
+		setChecked(mUseMediaKeys, viper.GetBool("useMediaKeys"))
+		updateMIDIChecks()
+		buildProfileMenu(mProfilesMenu, menuExit)
+		for _, v := range snapshots {
+			if !snapshotItems[v.name] {
+				addSnapshotMenuItem(mSnapshotsMenu, v.name, menuExit)
+				snapshotItems[v.name] = true
+			}
+		}
+	}
+
 	go func() { // loop for menu item 'Quit'
 		<-mQuitItem.ClickedCh
-		close(quitCh)   // quit readShuttle go routine
+		close(quitCh)   // quit readShuttle go routine, it closes the MIDI device
 		close(menuExit) // quit go routines for menu items
 		systray.Quit()
 	}()
-	// Instantiate MIDI Controller
-	startListeners(controlName, shuttlePro)
+	// Instantiate MIDI Controller, from now on it is only used by the event loop
+	openControl(profileMidiDevice(), true)
+	go readShuttle(quitCh, shuttlePro)
+	go watchMIDIPorts(mPortStatus, menuExit)
+	go blinkDisplay(menuExit)
+	go refreshMeters(menuExit)
+	go watchFocus(newFocusSource(), applyFocusRules, menuExit)
+	startOSCListener(menuExit)
+	watchConfig()
 }
 
-// startListeners creates and opens the specified MIDI device and starts the event handling goroutine readShuttle.
-// In case the goroutine is already running it is restarted.
-func startListeners(midiName string, shuttlePro *devices.ShuttleProV2) {
-	if quitCh != nil {
-		close(quitCh)
-		mControl.close()
+// setChecked checks or unchecks a checkbox menu item
+func setChecked(item *systray.MenuItem, checked bool) {
+	if checked {
+		item.Check()
+	} else {
+		item.Uncheck()
 	}
-	quitCh = make(chan struct{})
+}
 
-	mControl = newMIDIController(nil, midiName, messageRepeatDelay*time.Millisecond, 0)
-	if err := mControl.open(); err != nil {
-		dlgs.Error(applicationName, "Unable to open MIDI device. Please select the correct device in the context menu.\n"+err.Error())
+// setEnabled enables or disables the menu item
+func setEnabled(item *systray.MenuItem, enabled bool) {
+	if enabled {
+		item.Enable()
 	} else {
-		// init: send defaults to midi device
-		if viper.GetBool("useDisplay") {
-			refreshDisplay(viper.GetString("displayMidiDevice"))
+		item.Disable()
+	}
+}
+
+// addSnapshotMenuItem adds a sub menu item recalling the named snapshot, handled by its own goroutine
+func addSnapshotMenuItem(menu *systray.MenuItem, name string, menuExit chan struct{}) {
+	item := menu.AddSubMenuItem(name, "")
+	go func() {
+		for {
+			select {
+			case <-item.ClickedCh:
+				if !requestRecall(name) {
+					dlgs.Error(applicationName, "Unable to recall snapshot '"+name+"'. Is the MIDI device open?")
+				}
+			case <-menuExit:
+				return
+			}
 		}
-		mControl.sendCommand(mainVolumeCC, uint8(mainVolume), false)
-		mControl.sendCommand(headPhoneVolumeCC, uint8(headPhoneVolume), false)
+	}()
+}
 
-		go readShuttle(quitCh, shuttlePro, mControl)
+// openControl creates and opens the specified MIDI device with the channel of the active profile, replacing the
+// one used so far, and sends the current state to it. It must only be called by the event loop (see requestEvent) or
+// before the event loop is started. A failure is shown in a dialog if showError is set, e.g. after the user selected
+// the device, and only logged otherwise, e.g. for reconnects of the port watcher
+func openControl(midiName string, showError bool) {
+	if mControl != nil {
+		mControl.close()
 	}
+	mControl = newMIDIController(nil, midiName, messageRepeatDelay*time.Millisecond, activeProfile.channel)
+	controlConnected = false
+	clear(snapshotCCs) // unknown to the newly opened device
+	if err := mControl.open(); err != nil {
+		slog.Error("midi: can't open control MIDI device", "device", midiName, "err", err)
+		if showError { // don't block the event loop until the dialog is closed
+			go dlgs.Error(applicationName, "Unable to open MIDI device. Please select the correct device in the context menu.\n"+err.Error())
+		}
+		return
+	}
+	// init: send defaults to midi device
+	if viper.GetBool("useDisplay") {
+		refreshDisplay(currentDisplay())
+	}
+	if activeProfile.monitor {
+		mControl.sendCommand(mainVolumeCC, mainOutVolume(), false)
+		for i := range cues {
+			sendCueValue(mControl, i, uint8(cues[i].volume))
+		}
+	}
+	controlConnected = true
 }
 
-// readShuttle is the goroutine used to handle all ShuttlePro events and to send out the MIDI messages.
-// The routine is stopped by closing the quitch channel
-func readShuttle(quitCh chan struct{}, shuttlePro *devices.ShuttleProV2, midiController midiController) {
-
-	// doButton executes the MIDI command and changes the display text for the given button
-	doButton := func(buttonNumber int, buttonCommand int) {
-		switch buttonCommand {
-		case on:
-			midiController.sendCommand(csPro[buttonNumber].cc, CCvalueOn, false)
-			if csPro[buttonNumber].msgOn != "" {
-				if csPro[buttonNumber].LCDchannel != 0 {
-					if viper.GetBool("useDisplay") {
-						devices.DisplayLCDtext(viper.GetString("displayMidiDevice"), csPro[buttonNumber].LCDchannel, csPro[buttonNumber].LCDrow, csPro[buttonNumber].msgOn)
-					}
+// sendButtonCC sends the MIDI CC (or note) of the given button. The dim CC is suppressed if ShuttleMidi dims the volume itself
+func sendButtonCC(midiController midiController, buttonNumber int, value uint8) {
+	if buttonNumber == dimButton && activeProfile.monitor && activeProfile.buttons[buttonNumber].action == actionNone && internalDim() {
+		return
+	}
+	if activeProfile.buttons[buttonNumber].note {
+		midiController.sendNote(activeProfile.buttons[buttonNumber].cc, value > 0)
+		return
+	}
+	midiController.sendCommand(activeProfile.buttons[buttonNumber].cc, value, false)
+}
+
+// doButton executes the MIDI command and changes the display text for the given button
+func doButton(midiController midiController, buttonNumber int, buttonCommand int) {
+	switch buttonCommand {
+	case on:
+		sendButtonCC(midiController, buttonNumber, CCvalueOn)
+		if activeProfile.buttons[buttonNumber].msgOn != "" {
+			if activeProfile.buttons[buttonNumber].LCDchannel != 0 {
+				if viper.GetBool("useDisplay") {
+					showCell(activeProfile.buttons[buttonNumber].LCDchannel, activeProfile.buttons[buttonNumber].LCDrow, activeProfile.buttons[buttonNumber].msgOn)
 				}
 			}
-		case off:
-			midiController.sendCommand(csPro[buttonNumber].cc, CCvalueOff, false)
-			if csPro[buttonNumber].msgOff != "" {
-				if csPro[buttonNumber].LCDchannel != 0 {
-					if viper.GetBool("useDisplay") {
-						devices.DisplayLCDtext(viper.GetString("displayMidiDevice"), csPro[buttonNumber].LCDchannel, csPro[buttonNumber].LCDrow, csPro[buttonNumber].msgOff)
-					}
+		}
+	case off:
+		sendButtonCC(midiController, buttonNumber, CCvalueOff)
+		if activeProfile.buttons[buttonNumber].msgOff != "" {
+			if activeProfile.buttons[buttonNumber].LCDchannel != 0 {
+				if viper.GetBool("useDisplay") {
+					showCell(activeProfile.buttons[buttonNumber].LCDchannel, activeProfile.buttons[buttonNumber].LCDrow, activeProfile.buttons[buttonNumber].msgOff)
 				}
 			}
-		case toggle:
-			if csPro[buttonNumber].latch {
-				if csPro[buttonNumber].state {
-					midiController.sendCommand(csPro[buttonNumber].cc, CCvalueOff, false)
-					if csPro[buttonNumber].msgOff != "" {
-						if csPro[buttonNumber].LCDchannel != 0 {
-							if viper.GetBool("useDisplay") {
-								devices.DisplayLCDtext(viper.GetString("displayMidiDevice"), csPro[buttonNumber].LCDchannel, csPro[buttonNumber].LCDrow, csPro[buttonNumber].msgOff)
-							}
+		}
+	case toggle:
+		if activeProfile.buttons[buttonNumber].latch {
+			if activeProfile.buttons[buttonNumber].state {
+				sendButtonCC(midiController, buttonNumber, CCvalueOff)
+				if activeProfile.buttons[buttonNumber].msgOff != "" {
+					if activeProfile.buttons[buttonNumber].LCDchannel != 0 {
+						if viper.GetBool("useDisplay") {
+							showCell(activeProfile.buttons[buttonNumber].LCDchannel, activeProfile.buttons[buttonNumber].LCDrow, activeProfile.buttons[buttonNumber].msgOff)
 						}
 					}
-				} else {
-					midiController.sendCommand(csPro[buttonNumber].cc, CCvalueOn, false)
-					if csPro[buttonNumber].msgOn != "" {
-						if csPro[buttonNumber].LCDchannel != 0 {
-							if viper.GetBool("useDisplay") {
-								devices.DisplayLCDtext(viper.GetString("displayMidiDevice"), csPro[buttonNumber].LCDchannel, csPro[buttonNumber].LCDrow, csPro[buttonNumber].msgOn)
-							}
+				}
+			} else {
+				sendButtonCC(midiController, buttonNumber, CCvalueOn)
+				if activeProfile.buttons[buttonNumber].msgOn != "" {
+					if activeProfile.buttons[buttonNumber].LCDchannel != 0 {
+						if viper.GetBool("useDisplay") {
+							showCell(activeProfile.buttons[buttonNumber].LCDchannel, activeProfile.buttons[buttonNumber].LCDrow, activeProfile.buttons[buttonNumber].msgOn)
 						}
 					}
 				}
-				csPro[buttonNumber].state = !csPro[buttonNumber].state
 			}
-		default:
+			activeProfile.buttons[buttonNumber].state = !activeProfile.buttons[buttonNumber].state
+		}
+	default:
+	}
+	showIndicators()
+}
+
+// doAction executes the special action a button is mapped to. It returns false if the button has no action and the
+// default button handling should be used
+func doAction(midiController midiController, buttonNumber int, pressed bool) bool {
+	switch activeProfile.buttons[buttonNumber].action {
+	case actionTalkback:
+		doTalkback(midiController, buttonNumber, pressed)
+	case actionSelectCue:
+		if pressed {
+			selectNextCue(buttonNumber)
+		}
+	case actionABCompare:
+		if pressed {
+			doABCompare(midiController, buttonNumber)
+		}
+	case actionSnapshot:
+		if pressed {
+			if err := recallSnapshot(midiController, activeProfile.buttons[buttonNumber].arg); err != nil {
+				slog.Error("can't recall snapshot", "name", activeProfile.buttons[buttonNumber].arg, "err", err)
+			}
+		}
+	case actionCycleProfile:
+		if pressed {
+			cycleProfile()
 		}
+	case actionNextPage:
+		if pressed {
+			nextDisplayPage()
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// doMonitorButton executes the monitor controller function of a button pressed in a monitor profile
+func doMonitorButton(midiController midiController, buttonNumber int) {
+	switch buttonNumber {
+	case LRbutton: // only toggle main if headPhones are off
+		if !activeProfile.buttons[headPhoneButton].state {
+			doButton(midiController, LRbutton, toggle)
+		}
+	case headPhoneButton:
+		if activeProfile.buttons[headPhoneButton].state { // headPhone -> off, LR + LFE -> on
+			if activeProfile.buttons[LRbutton].state { // back to previous state
+				doButton(midiController, LRbutton, on)
+			}
+			if activeProfile.buttons[LFEbutton].state {
+				doButton(midiController, LFEbutton, on)
+			}
+			if activeProfile.buttons[LsRsButton].state {
+				doButton(midiController, LsRsButton, on)
+			}
+		} else { // turn headPhones on, everything else off
+			doButton(midiController, LRbutton, off)
+			doButton(midiController, LFEbutton, off)
+			doButton(midiController, LsRsButton, off)
+		}
+		doButton(midiController, headPhoneButton, toggle)
+	case 4, 5, 6, 7: // previous, next, stop, play
+		if viper.GetBool("useMediaKeys") {
+			sendMediaKey(buttonNumber - 4)
+			break
+		}
+		doButton(midiController, buttonNumber, on)
+	case stereoSurroundButton:
+		if activeProfile.buttons[stereoSurroundButton].state { // surroundMode -> off, LsRs to previous state
+			if !activeProfile.buttons[LsRsButton].state {
+				doButton(midiController, LsRsButton, off)
+			}
+		} else { // surroundMode -> on, turn LsRs on
+			doButton(midiController, LsRsButton, on)
+		}
+		doButton(midiController, stereoSurroundButton, toggle)
+	case dimButton:
+		doButton(midiController, dimButton, toggle)
+		if internalDim() { // attenuate or restore the main volume
+			sendMainVolume(midiController)
+		}
+	default:
+		doButton(midiController, buttonNumber, toggle)
+	}
+}
+
+// handleButton executes the function of the active profile for a button press or release
+func handleButton(midiController midiController, buttonNumber int, pressed bool) {
+	if doAction(midiController, buttonNumber, pressed) || !pressed {
+		return
+	}
+	if activeProfile.monitor {
+		doMonitorButton(midiController, buttonNumber)
+		return
+	}
+	if activeProfile.buttons[buttonNumber].latch {
+		doButton(midiController, buttonNumber, toggle)
+	} else {
+		doButton(midiController, buttonNumber, on)
+	}
+}
+
+// buttonEvent is a press or release of a ShuttlePro button
+type buttonEvent struct {
+	number  int
+	pressed bool
+}
+
+// shuttleButtons creates the button channels of the ShuttlePro and forwards the events of all of them to the returned
+// channel. The goroutines are stopped by closing quitCh
+func shuttleButtons(quitCh chan struct{}, shuttlePro *devices.ShuttleProV2) chan buttonEvent {
+	// forward the events of all button channels to buttonCh
+	buttonCh := make(chan buttonEvent)
+	buttonChannels := []*chan bool{
+		&shuttlePro.Button1Pressed, &shuttlePro.Button2Pressed, &shuttlePro.Button3Pressed, &shuttlePro.Button4Pressed,
+		&shuttlePro.Button5Pressed, &shuttlePro.Button6Pressed, &shuttlePro.Button7Pressed, &shuttlePro.Button8Pressed,
+		&shuttlePro.Button9Pressed, &shuttlePro.Button10Pressed, &shuttlePro.Button11Pressed, &shuttlePro.Button12Pressed,
+		&shuttlePro.Button13Pressed, &shuttlePro.Button14Pressed, &shuttlePro.Button15Pressed,
+	}
+	for i, ch := range buttonChannels {
+		*ch = make(chan bool)
+		go func(number int, ch chan bool) {
+			for {
+				select {
+				case pressed := <-ch:
+					select {
+					case buttonCh <- buttonEvent{number: number, pressed: pressed}:
+					case <-quitCh:
+						return
+					}
+				case <-quitCh:
+					return
+				}
+			}
+		}(i, *ch)
+	}
+	return buttonCh
+}
+
+// turnVolume returns the volume changed by delta for a dial step, increased when turned clockwise. The result is kept
+// within 0 and the highest entry of headPhoneVolTable, which is indexed by the volume
+func turnVolume(volume float32, delta float32, clockwise bool) float32 {
+	if clockwise {
+		return min(volume+delta, float32(len(headPhoneVolTable)-1))
 	}
+	return max(volume-delta, 0)
+}
 
+// readShuttle is the event loop handling all ShuttlePro events and the requests of the tray menu and the watchers
+// (see requestEvent), it sends out the MIDI messages to mControl. Events are handled while the control MIDI device
+// is disconnected as well, the state is sent again on reconnect. The routine is stopped by closing the quitch channel,
+// it closes mControl then
+func readShuttle(quitCh chan struct{}, shuttlePro *devices.ShuttleProV2) {
 	shuttlePro.WheelPosition = make(chan int8)
 	shuttlePro.DialDirection = make(chan int8)
+	buttonCh := shuttleButtons(quitCh, shuttlePro)
 
-	shuttlePro.Button1Pressed = make(chan bool)
-	shuttlePro.Button2Pressed = make(chan bool)
-	shuttlePro.Button3Pressed = make(chan bool)
-	shuttlePro.Button4Pressed = make(chan bool)
-	shuttlePro.Button5Pressed = make(chan bool)
-	shuttlePro.Button6Pressed = make(chan bool)
-	shuttlePro.Button7Pressed = make(chan bool)
-	shuttlePro.Button8Pressed = make(chan bool)
-	shuttlePro.Button9Pressed = make(chan bool)
-	shuttlePro.Button10Pressed = make(chan bool)
-	shuttlePro.Button11Pressed = make(chan bool)
-	shuttlePro.Button12Pressed = make(chan bool)
-	shuttlePro.Button13Pressed = make(chan bool)
-	shuttlePro.Button14Pressed = make(chan bool)
-	shuttlePro.Button15Pressed = make(chan bool)
+	pressedButtons := make([]bool, len(activeProfile.buttons))
+	chordFired := false
 
 	for {
 		select {
 		case <-quitCh:
+			mControl.close()
 			return
+		case f := <-requestCh:
+			f()
 		case wp := <-shuttlePro.WheelPosition:
 			if wp > 0 && wp <= 7 {
 				// Invert positive wheel positions
-				midiController.sendCommand(0, uint8(18*(8-wp)), true)
+				mControl.sendCommand(activeProfile.wheelCCs[0], uint8(18*(8-wp)), true)
 			} else if wp >= -7 && wp < 0 {
-				midiController.sendCommand(1, uint8(18*(-wp)), true)
+				mControl.sendCommand(activeProfile.wheelCCs[1], uint8(18*(-wp)), true)
 			} else {
-				midiController.sendCommand(0, 255, false)
-				midiController.sendCommand(1, 255, false)
+				mControl.sendCommand(activeProfile.wheelCCs[0], 255, false)
+				mControl.sendCommand(activeProfile.wheelCCs[1], 255, false)
 			}
 		case dd := <-shuttlePro.DialDirection:
-			if dd == 1 { // clockwise: increase value
-				if csPro[headPhoneButton].state { // headPhones on
-					headPhoneVolume = headPhoneVolume + headPhoneVolumeDelta
-					if headPhoneVolume > 127 {
-						headPhoneVolume = 127
-					}
-					if viper.GetBool("useDisplay") {
-						devices.DisplayLCDtext(viper.GetString("displayMidiDevice"), csPro[headPhoneButton].LCDchannel, lowerRow, headPhoneVolTable[uint8(headPhoneVolume)])
-					}
-					midiController.sendCommand(headPhoneVolumeCC, uint8(headPhoneVolume), false)
-				} else { // headPhones off
-					mainVolume = mainVolume + mainVolumeDelta
-					if mainVolume > 127 {
-						mainVolume = 127
-					}
-					if viper.GetBool("useDisplay") {
-						devices.DisplayLCDtext(viper.GetString("displayMidiDevice"), csPro[LRbutton].LCDchannel, lowerRow, mainVolTable[uint8(mainVolume)])
-					}
-					midiController.sendCommand(mainVolumeCC, uint8(mainVolume), false)
-				}
-			} else { // counter clockwise: decrease value
-				if csPro[headPhoneButton].state { // headPhones on
-					if headPhoneVolume > 0 {
-						headPhoneVolume = headPhoneVolume - headPhoneVolumeDelta
-					}
-					if viper.GetBool("useDisplay") {
-						devices.DisplayLCDtext(viper.GetString("displayMidiDevice"), csPro[headPhoneButton].LCDchannel, lowerRow, headPhoneVolTable[uint8(headPhoneVolume)])
-					}
-					midiController.sendCommand(headPhoneVolumeCC, uint8(headPhoneVolume), false)
+			if !activeProfile.monitor { // relative CC: 1 = clockwise, 127 = counter clockwise
+				if dd == 1 {
+					mControl.sendCommand(activeProfile.dialCC, 1, false)
 				} else {
-					if mainVolume > 0 {
-						mainVolume = mainVolume - mainVolumeDelta
-					}
-					if viper.GetBool("useDisplay") {
-						devices.DisplayLCDtext(viper.GetString("displayMidiDevice"), csPro[LRbutton].LCDchannel, lowerRow, mainVolTable[uint8(mainVolume)])
-					}
-					midiController.sendCommand(mainVolumeCC, uint8(mainVolume), false)
-				}
-			}
-		case b0 := <-shuttlePro.Button1Pressed: // only toggle main if headPhones are off
-			if b0 {
-				if !csPro[headPhoneButton].state {
-					doButton(LRbutton, toggle)
+					mControl.sendCommand(activeProfile.dialCC, 127, false)
 				}
+			} else if c := dialCue(); c >= 0 { // a cue (e.g. headPhones) is controlled by the dial
+				cues[c].volume = turnVolume(cues[c].volume, headPhoneVolumeDelta, dd == 1)
+				sendCueVolume(mControl, c)
+			} else {
+				mainVolume = turnVolume(mainVolume, mainVolumeDelta, dd == 1)
+				sendMainVolume(mControl)
 			}
-		case b1 := <-shuttlePro.Button2Pressed:
-			if b1 {
-				doButton(LFEbutton, toggle)
-			}
-		case b2 := <-shuttlePro.Button3Pressed:
-			if b2 {
-				doButton(LsRsButton, toggle)
-			}
-		case b3 := <-shuttlePro.Button4Pressed:
-			if b3 {
-				if csPro[headPhoneButton].state { // headPhone -> off, LR + LFE -> on
-					if csPro[LRbutton].state { // back to previous state
-						doButton(LRbutton, on)
-					}
-					if csPro[LFEbutton].state {
-						doButton(LFEbutton, on)
-					}
-					if csPro[LsRsButton].state {
-						doButton(LsRsButton, on)
-					}
-				} else { // turn headPhones on, everything else off
-					doButton(LRbutton, off)
-					doButton(LFEbutton, off)
-					doButton(LsRsButton, off)
-				}
-				doButton(headPhoneButton, toggle)
-			}
-		case b4 := <-shuttlePro.Button5Pressed: // previous
-			if b4 {
-				if viper.GetBool("useMediaKeys") {
-					sendMediaKey(previous)
-					break
-				}
-				doButton(4, on)
-			}
-		case b5 := <-shuttlePro.Button6Pressed: // next
-			if b5 {
-				if viper.GetBool("useMediaKeys") {
-					sendMediaKey(next)
-					break
-				}
-				doButton(5, on)
-			}
-		case b6 := <-shuttlePro.Button7Pressed: // stop
-			if b6 {
-				if viper.GetBool("useMediaKeys") {
-					sendMediaKey(stop)
-					break
-				}
-				doButton(6, on)
+		case ev := <-buttonCh:
+			chord := profileChord()
+			wasPressed := pressedButtons[ev.number]
+			pressedButtons[ev.number] = ev.pressed
+			if !chord[ev.number] {
+				handleButton(mControl, ev.number, ev.pressed)
+				break
 			}
-		case b7 := <-shuttlePro.Button8Pressed: // play
-			if b7 {
-				if viper.GetBool("useMediaKeys") {
-					sendMediaKey(play)
-					break
+			// buttons of the profile chord act on release, unless the chord was pressed
+			if ev.pressed {
+				if chordPressed(chord, pressedButtons) {
+					chordFired = true
+					cycleProfile()
 				}
-				doButton(7, on)
-			}
-		case b8 := <-shuttlePro.Button9Pressed:
-			if b8 {
-				if csPro[stereoSurroundButton].state { // surroundMode -> off, LsRs to previous state
-					if !csPro[LsRsButton].state {
-						doButton(LsRsButton, off)
-					}
-				} else { // surroundMode -> on, turn LsRs on
-					doButton(LsRsButton, on)
+			} else if chordFired {
+				if !chordPartlyPressed(chord, pressedButtons) {
+					chordFired = false
 				}
-				doButton(stereoSurroundButton, toggle)
-			}
-		case b9 := <-shuttlePro.Button10Pressed:
-			if b9 {
-				doButton(9, toggle)
-			}
-		case b10 := <-shuttlePro.Button11Pressed:
-			if b10 {
-				doButton(10, toggle)
-			}
-		case b11 := <-shuttlePro.Button12Pressed:
-			if b11 {
-				doButton(11, toggle)
-			}
-		case b12 := <-shuttlePro.Button13Pressed:
-			if b12 {
-				doButton(12, toggle)
-			}
-		case b13 := <-shuttlePro.Button14Pressed:
-			if b13 {
-				doButton(13, toggle)
-			}
-		case b14 := <-shuttlePro.Button15Pressed:
-			if b14 {
-				doButton(14, toggle)
+			} else if wasPressed {
+				handleButton(mControl, ev.number, true)
+				handleButton(mControl, ev.number, false)
 			}
 		}
 	}
 }
 
-// onExit is called by systray on exit and closes the MidiController
+// onExit is called by systray on exit, it sends the pending display updates. The MidiController is closed by the
+// event loop
 func onExit() {
-	if mControl != nil {
-		mControl.close()
-	}
+	drainDisplay()
 }
 
 func main() {
+	args, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(2)
+	}
+	if !isRunCommand(args) {
+		os.Exit(runCommand(args))
+	}
 	if err := initSettings(); err != nil {
 		slog.Error("initSettings not successful: ", err)
 		return
 	}
+	if err := loadConfig(lastGoodConfig); err != nil {
+		slog.Error("config: invalid settings, using the built-in config", "err", err)
+		if err := loadBuiltinConfig(); err != nil {
+			slog.Error("config: invalid built-in config", "err", err)
+			return
+		}
+	}
 	systray.Run(onReady, onExit)
 }
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestTurnVolume(t *testing.T) {
+	tests := []struct {
+		name      string
+		volume    float32
+		clockwise bool
+		want      float32
+	}{
+		{"increase", 60, true, 61.4},
+		{"decrease", 60, false, 58.6},
+		{"decrease to zero", 0.3, false, 0},
+		{"zero stays", 0, false, 0},
+		{"increase to maximum", 126.7, true, 127},
+		{"maximum stays", 127, true, 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := turnVolume(tt.volume, headPhoneVolumeDelta, tt.clockwise)
+			if got != tt.want {
+				t.Errorf("turnVolume(%v, %v, %v) = %v, want %v", tt.volume, headPhoneVolumeDelta, tt.clockwise, got,
+					tt.want)
+			}
+			_ = headPhoneVolTable[uint8(got)] // the volume is used as index
+		})
+	}
+}
@@ -4,7 +4,6 @@ package main
 
 import (
 	"errors"
-	"strings"
 	"time"
 
 	"log/slog"
@@ -31,6 +30,7 @@ type midiController interface {
 	open() error
 	close() error
 	sendCommand(controller uint8, value uint8, repeat bool) error
+	sendNote(key uint8, on bool) error
 }
 
 // midiControllerCommand contains a single command that will be send out
@@ -38,6 +38,7 @@ type midiControllerCommand struct {
 	controller uint8
 	value      uint8
 	repeat     bool
+	note       bool // send a NoteOn (value > 0) or NoteOff message for key 'controller' instead of a ControlChange
 }
 
 // midiControl contains all driver and channel variables required for the communication
@@ -51,6 +52,8 @@ type midiControl struct {
 
 	commandCh chan *midiControllerCommand
 	quitCh    chan struct{}
+
+	writeFailed bool // the last message couldn't be sent, used by commandExecutor only
 }
 
 // NewMIDIController creates a new MidiController instance with the specified parameters. If nil is passed as driver
@@ -103,16 +106,15 @@ func (mc *midiControl) open() error {
 	if err != nil {
 		slog.Error("midi.driver: can't find out ports", err)
 	}
-	for i, v := range outs {
-		// slog.Info(fmt.Sprint(i) + " " + v.String())
-		if strings.Contains(v.String(), mc.deviceName) {
-			mc.output = outs[i]
-		}
+	names := make([]string, 0, len(outs))
+	for _, v := range outs {
+		names = append(names, v.String())
 	}
-
-	if mc.output == nil {
-		return errMIDIDeviceNotFound
+	index, err := matchMIDIPort(mc.deviceName, names)
+	if err != nil {
+		return err
 	}
+	mc.output = outs[index]
 
 	if err := mc.output.Open(); err != nil {
 		slog.Error("midi.port: can't open selected port", err)
@@ -133,8 +135,13 @@ func (mc *midiControl) close() error {
 	if mc.quitCh != nil {
 		close(mc.quitCh)
 	}
-	errout := mc.output.Close()
-	errdrv := mc.driver.Close()
+	var errout, errdrv error
+	if mc.output != nil { // open might have failed
+		errout = mc.output.Close()
+	}
+	if mc.driver != nil {
+		errdrv = mc.driver.Close()
+	}
 
 	if errout != nil {
 		return errout
@@ -154,8 +161,37 @@ func (mc *midiControl) sendCommand(controller uint8, value uint8, repeat bool) e
 		return errMIDIDeviceNotInitialized
 	}
 	cmd := &midiControllerCommand{controller: controller, value: value, repeat: repeat}
-	mc.commandCh <- cmd
-	return nil
+	return mc.send(cmd)
+}
+
+// SendNote sends a NoteOn (full velocity) or NoteOff MIDI message for the specified key to the current MIDI device
+func (mc *midiControl) sendNote(key uint8, on bool) error {
+	if mc.output == nil {
+		return errMIDIDeviceNotInitialized
+	}
+	cmd := &midiControllerCommand{controller: key, note: true}
+	if on {
+		cmd.value = CCvalueOn
+	}
+	return mc.send(cmd)
+}
+
+// send passes the command to commandExecutor. Commands for a closed device are dropped
+func (mc *midiControl) send(cmd *midiControllerCommand) error {
+	select {
+	case mc.commandCh <- cmd:
+		return nil
+	case <-mc.quitCh:
+		return errMIDIDeviceNotInitialized
+	}
+}
+
+// reportWriteError logs a failed message. Further failures are not logged until a message was sent successfully
+func (mc *midiControl) reportWriteError(err error) {
+	if err != nil && !mc.writeFailed {
+		slog.Error("midi: can't send message", "device", mc.deviceName, "err", err)
+	}
+	mc.writeFailed = err != nil
 }
 
 // commandExecutor sends out MIDI messages received through the commandch channel. It also takes care of sending messages out
@@ -178,8 +214,16 @@ func (mc *midiControl) commandExecutor() {
 			return
 		case cmd := <-mc.commandCh:
 			//slog.Info("Controller: %v, Value: %v, Repeat: %v\n", cmd.controller, cmd.value, cmd.repeat)
+			if cmd.note {
+				if cmd.value > 0 {
+					mc.reportWriteError(writer.NoteOn(mc.writer, cmd.controller, cmd.value))
+				} else {
+					mc.reportWriteError(writer.NoteOff(mc.writer, cmd.controller))
+				}
+				break
+			}
 			if cmd.value <= 127 {
-				writer.ControlChange(mc.writer, cmd.controller, cmd.value)
+				mc.reportWriteError(writer.ControlChange(mc.writer, cmd.controller, cmd.value))
 			}
 			if cmd.repeat {
 				repeatcmd[cmd.controller] = tickStruct{counter: midiMaxRepeat, value: cmd.value}
@@ -194,7 +238,7 @@ func (mc *midiControl) commandExecutor() {
 			for k, v := range repeatcmd {
 				if v.counter > 1 {
 					//log.Printf("Controller: %v, Value: %v, Repeat-Counter: %v\n", k, v.value, v.counter)
-					writer.ControlChange(mc.writer, k, v.value)
+					mc.reportWriteError(writer.ControlChange(mc.writer, k, v.value))
 					v.counter--
 					repeatcmd[k] = v
 				} else {
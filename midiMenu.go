@@ -0,0 +1,142 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+
+	"fyne.io/systray"
+	"github.com/spf13/viper"
+	"gitlab.com/gomidi/midi"
+)
+
+// midiPortItems are the menu items of a MIDI port in the control and display device sub menus
+type midiPortItems struct {
+	control *systray.MenuItem
+	display *systray.MenuItem
+	exit    chan struct{} // stops the goroutine of the items, nil while the port is missing
+}
+
+var (
+	// midiMenuMutex guards the MIDI device sub menus, which are updated by the tray and by watchMIDIPorts
+	midiMenuMutex sync.Mutex
+	// mControlMIDIMenu and mDisplayMIDIMenu are the parents of the MIDI device sub menus
+	mControlMIDIMenu *systray.MenuItem
+	mDisplayMIDIMenu *systray.MenuItem
+	// midiPortMenuItems contains the items of all ports ever found. Items of missing ports are hidden, as systray
+	// can't remove menu items
+	midiPortMenuItems = map[string]*midiPortItems{}
+	// midiMenuPorts are the ports currently shown, in the order of enumeration
+	midiMenuPorts []string
+)
+
+// updateMIDIMenus shows an item for each port in the MIDI device sub menus. Items of ports which disappeared are
+// hidden and their goroutines stopped, items of new ports are added
+func updateMIDIMenus(ports []string, menuExit chan struct{}) {
+	midiMenuMutex.Lock()
+	defer midiMenuMutex.Unlock()
+
+	if slices.Equal(ports, midiMenuPorts) && midiMenuPorts != nil {
+		return
+	}
+	for name, items := range midiPortMenuItems {
+		if items.exit != nil && !slices.Contains(ports, name) {
+			slog.Info("midi: port removed from menu", "port", name)
+			close(items.exit)
+			items.exit = nil
+			items.control.Hide()
+			items.display.Hide()
+		}
+	}
+	for _, name := range ports {
+		items, found := midiPortMenuItems[name]
+		switch {
+		case !found:
+			items = &midiPortItems{
+				control: mControlMIDIMenu.AddSubMenuItemCheckbox(name, "", false),
+				display: mDisplayMIDIMenu.AddSubMenuItemCheckbox(name, "", false),
+			}
+			midiPortMenuItems[name] = items
+		case items.exit == nil:
+			items.control.Show()
+			items.display.Show()
+		default:
+			continue
+		}
+		items.exit = make(chan struct{})
+		go handleMIDIPortItems(name, items, menuExit)
+	}
+	midiMenuPorts = ports
+	setMIDIChecks()
+}
+
+// handleMIDIPortItems is the goroutine handling the menu items of a MIDI port. The selection is applied by the event
+// loop
+func handleMIDIPortItems(name string, items *midiPortItems, menuExit chan struct{}) {
+	itemsExit := items.exit
+	for {
+		select {
+		case <-items.control.ClickedCh:
+			requestEvent(func() {
+				if activeProfile.midiDevice != "" {
+					slog.Info("MIDI device of the profile used, the control device isn't changed", "profile",
+						activeProfile.name, "midiDevice", activeProfile.midiDevice)
+					return
+				}
+				viper.Set("controlMidiDevice", exactPortSpec(name))
+				writeConfig("controlMidiDevice")
+				updateMIDIChecks()
+				openControl(profileMidiDevice(), true)
+			})
+		case <-items.display.ClickedCh:
+			requestEvent(func() {
+				viper.Set("displayMidiDevice", exactPortSpec(name))
+				writeConfig("displayMidiDevice")
+				updateMIDIChecks()
+				checkDisplayPort(midiPortNames)
+			})
+		case <-itemsExit:
+			return
+		case <-menuExit:
+			return
+		}
+	}
+}
+
+// updateMIDIChecks checks the menu items of the selected control and display MIDI devices
+func updateMIDIChecks() {
+	midiMenuMutex.Lock()
+	defer midiMenuMutex.Unlock()
+	setMIDIChecks()
+}
+
+// setMIDIChecks checks the menu items of the selected devices, the control device used by the active profile. The
+// control items are disabled while the profile selects its own MIDI device. midiMenuMutex must be held
+func setMIDIChecks() {
+	for i, name := range midiMenuPorts {
+		items := midiPortMenuItems[name]
+		setChecked(items.control, portSelected(profileMidiDevice(), midiMenuPorts, i))
+		setEnabled(items.control, activeProfile.midiDevice == "")
+		setChecked(items.display, portSelected(viper.GetString("displayMidiDevice"), midiMenuPorts, i))
+	}
+}
+
+// midiPorts enumerates the MIDI ports using driver, a temporary one if nil. Failures are logged
+func midiPorts(driver midi.Driver) ([]string, bool) {
+	ports, err := getMIDIDevices(driver)
+	if err != nil {
+		slog.Error("devices: can't get MIDIdevices", "err", err)
+		return nil, false
+	}
+	return ports, true
+}
+
+// rescanMIDIPorts enumerates the MIDI ports and lets the event loop update the MIDI device sub menus and the display
+func rescanMIDIPorts(menuExit chan struct{}) {
+	if ports, ok := midiPorts(nil); ok {
+		requestEvent(func() {
+			updateMIDIMenus(ports, menuExit)
+			checkDisplayPort(ports)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	errInvalidPortSpec = errors.New("invalid MIDI port selection")
+
+	// alsaPortNumbers matches the client and port numbers ALSA appends to port names, e.g. "X-Touch INT 20:0". They
+	// change when devices are plugged in in a different order
+	alsaPortNumbers = regexp.MustCompile(`\s+\d+:\d+$`)
+
+	// midiPortNames are the MIDI ports enumerated last
+	midiPortNames []string
+	// displayPortName is the port of the display MIDI device among midiPortNames, "" if it wasn't found
+	displayPortName string
+)
+
+// portIdentity returns the port name without the numbers that change between sessions
+func portIdentity(name string) string {
+	return alsaPortNumbers.ReplaceAllString(name, "")
+}
+
+// exactPortSpec returns the port selection stored for a port picked by the user, e.g. from the tray menu
+func exactPortSpec(name string) string {
+	return "exact:" + portIdentity(name)
+}
+
+// parsePortSpec splits a port selection into its kind ("index", "regex", "exact" or "" for plain names) and value
+func parsePortSpec(spec string) (string, string, error) {
+	kind, value, found := strings.Cut(spec, ":")
+	switch {
+	case !found:
+		return "", spec, nil
+	case kind == "index":
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", "", fmt.Errorf("%w: %s: index must be a number", errInvalidPortSpec, spec)
+		}
+	case kind == "regex":
+		if _, err := regexp.Compile(value); err != nil {
+			return "", "", fmt.Errorf("%w: %s: %v", errInvalidPortSpec, spec, err)
+		}
+	case kind == "exact":
+	default: // a plain name containing a colon, e.g. an ALSA port name
+		return "", spec, nil
+	}
+	return kind, value, nil
+}
+
+// findMIDIPorts returns the indexes of all ports selected by spec:
+//
+//	index:2            the port with index 2, as listed by 'shuttleMidi list-midi'
+//	regex:^X-Touch     the ports matching the regular expression
+//	exact:X-Touch INT  the ports with exactly this name, ignoring ALSA client and port numbers
+//	X-Touch            the ports named exactly like this, or else all ports containing the text
+func findMIDIPorts(spec string, ports []string) ([]int, error) {
+	kind, value, err := parsePortSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	result := []int{}
+	switch kind {
+	case "index":
+		if i, _ := strconv.Atoi(value); i >= 0 && i < len(ports) {
+			result = append(result, i)
+		}
+	case "regex":
+		re := regexp.MustCompile(value)
+		for i, v := range ports {
+			if re.MatchString(v) {
+				result = append(result, i)
+			}
+		}
+	default:
+		for i, v := range ports {
+			if v == value || portIdentity(v) == portIdentity(value) {
+				result = append(result, i)
+			}
+		}
+		if kind == "" && len(result) == 0 {
+			for i, v := range ports {
+				if strings.Contains(v, value) {
+					result = append(result, i)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// matchMIDIPort returns the index of the port selected by spec (see findMIDIPorts). If several ports match, a
+// warning is logged and the last one is used, like previous versions did for plain names
+func matchMIDIPort(spec string, ports []string) (int, error) {
+	matches, err := findMIDIPorts(spec, ports)
+	if err != nil {
+		return 0, err
+	}
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("%w: %s", errMIDIDeviceNotFound, spec)
+	}
+	if len(matches) > 1 {
+		names := make([]string, 0, len(matches))
+		for _, v := range matches {
+			names = append(names, ports[v])
+		}
+		slog.Warn("midi: ambiguous port selection, using the last port. Use 'exact:', 'regex:' or 'index:' to select one",
+			"selection", spec, "ports", names, "port", names[len(names)-1])
+	}
+	return matches[len(matches)-1], nil
+}
+
+// portSelected reports if the port is the one selected by spec, used for the check marks of the tray menu
+func portSelected(spec string, ports []string, index int) bool {
+	matches, err := findMIDIPorts(spec, ports)
+	return err == nil && len(matches) > 0 && matches[len(matches)-1] == index
+}
+
+// updateDisplayPort selects the port of the display MIDI device 'displayMidiDevice' among ports, the MIDI ports
+// enumerated last, and reports if it changed. Like the control port the last matching port is used. The full port
+// name is passed to sendmidi, so its own partial matching of names doesn't undo a selection by 'exact:', 'regex:' or
+// 'index:'. It runs within the event loop
+func updateDisplayPort(ports []string) bool {
+	midiPortNames = ports
+	spec := viper.GetString("displayMidiDevice")
+	name := ""
+	matches, _ := findMIDIPorts(spec, ports)
+	if len(matches) > 0 {
+		name = ports[matches[len(matches)-1]]
+	}
+	if name == displayPortName {
+		return false
+	}
+	displayPortName = name
+	switch {
+	case name == "":
+		slog.Warn("midi: display port not found", "device", spec)
+	case len(matches) > 1:
+		slog.Warn("midi: ambiguous port selection, using the last port. Use 'exact:', 'regex:' or 'index:' to select one",
+			"selection", spec, "port", name)
+	default:
+		slog.Info("midi: display port found", "device", spec, "port", name)
+	}
+	return true
+}
+
+// displayPortFound reports if the display MIDI device was found among the MIDI ports
+func displayPortFound() bool {
+	return displayPortName != ""
+}
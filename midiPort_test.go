@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec      string
+		wantKind  string
+		wantValue string
+		wantErr   bool
+	}{
+		{"X-Touch", "", "X-Touch", false},
+		{"X-Touch INT 20:0", "", "X-Touch INT 20:0", false}, // ALSA port name, not a kind
+		{"exact:X-Touch INT", "exact", "X-Touch INT", false},
+		{"regex:^X-Touch", "regex", "^X-Touch", false},
+		{"regex:([", "", "", true},
+		{"index:2", "index", "2", false},
+		{"index:two", "", "", true},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		kind, value, err := parsePortSpec(tt.spec)
+		if kind != tt.wantKind || value != tt.wantValue || (err != nil) != tt.wantErr {
+			t.Errorf("parsePortSpec(%q) = %q, %q, %v, want %q, %q, error %v", tt.spec, kind, value, err, tt.wantKind,
+				tt.wantValue, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, errInvalidPortSpec) {
+			t.Errorf("parsePortSpec(%q) error %v isn't errInvalidPortSpec", tt.spec, err)
+		}
+	}
+}
+
+func TestMatchMIDIPort(t *testing.T) {
+	ports := []string{"Midi Through Port-0 14:0", "X-Touch INT 20:0", "X-Touch EXT 20:1", "X-Touch INT 24:0",
+		"IAC Driver Bus 1"}
+	tests := []struct {
+		spec    string
+		want    int
+		wantErr error
+	}{
+		{"IAC Driver Bus 1", 4, nil},
+		{"X-Touch EXT", 2, nil},            // contained in the port name
+		{"X-Touch", 3, nil},                // ambiguous, the last match is used
+		{"exact:X-Touch INT", 3, nil},      // ignoring ALSA client and port numbers
+		{"exact:X-Touch INT 20:0", 3, nil}, // the numbers change between sessions
+		{"exact:X-Touch", 0, errMIDIDeviceNotFound},
+		{"regex:^X-Touch (INT|EXT) 20", 2, nil},
+		{"index:1", 1, nil},
+		{"index:5", 0, errMIDIDeviceNotFound},
+		{"Launchpad", 0, errMIDIDeviceNotFound},
+		{"regex:([", 0, errInvalidPortSpec},
+	}
+	for _, tt := range tests {
+		got, err := matchMIDIPort(tt.spec, ports)
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && got != tt.want) {
+			t.Errorf("matchMIDIPort(%q) = %d, %v, want %d, %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPortSelected(t *testing.T) {
+	ports := []string{"X-Touch INT 20:0", "X-Touch INT 24:0"}
+	if portSelected("exact:X-Touch INT", ports, 0) || !portSelected("exact:X-Touch INT", ports, 1) {
+		t.Error("only the last matching port must be selected")
+	}
+	if portSelected("regex:([", ports, 0) {
+		t.Error("invalid selection selects a port")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configMigration upgrades the settings of a config file by one version. Override files only contain the keys they
+// change, so no other keys must be added to them
+type configMigration func(settings map[string]interface{}, override bool) error
+
+var (
+	errConfigTooNew = errors.New("config file was written by a newer version of ShuttleMidi")
+
+	// configMigrations contains the migration to each version, starting with version 2. Files without the key
+	// 'configVersion' are version 1
+	configMigrations = map[int]configMigration{
+		2: migrateExplicitProfile,
+	}
+)
+
+// settingsKey returns the key of the settings map matching key case insensitively, as viper writes lower case keys
+func settingsKey(settings map[string]interface{}, key string) (string, bool) {
+	for k := range settings {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// configVersion returns the version of the settings of a config file
+func configVersion(settings map[string]interface{}) (int, error) {
+	key, found := settingsKey(settings, "configVersion")
+	if !found {
+		return 1, nil
+	}
+	version, ok := toInt(settings[key])
+	if !ok {
+		return 0, fmt.Errorf("invalid configVersion %v", settings[key])
+	}
+	return version, nil
+}
+
+// migrateExplicitProfile moves the built-in monitor profile and the button actions of the key 'buttonActions' into
+// an explicit profile of the key 'profiles'. Files which already contain profiles only lose 'buttonActions', which
+// was ignored for them. Override files never get profiles, they would replace the ones of the config file. They
+// only lose 'buttonActions', the buttons have to be defined in the profiles of the config file instead
+func migrateExplicitProfile(settings map[string]interface{}, override bool) error {
+	if override {
+		if key, found := settingsKey(settings, "buttonActions"); found {
+			slog.Warn("config: buttonActions of an override file dropped, define the buttons in the profiles instead",
+				"buttonActions", settings[key])
+			delete(settings, key)
+		}
+		return nil
+	}
+	var actions map[string]interface{}
+	if key, found := settingsKey(settings, "buttonActions"); found {
+		actions, _ = normalize(settings[key]).(map[string]interface{})
+		delete(settings, key)
+	}
+	if key, found := settingsKey(settings, "profiles"); found {
+		if l, _ := normalize(settings[key]).([]interface{}); len(l) > 0 {
+			return nil
+		}
+		delete(settings, key)
+	}
+
+	p := builtinProfile().config()
+	buttons := p["buttons"].([]map[string]interface{})
+	for k, v := range actions {
+		buttonNumber, err := strconv.Atoi(k)
+		if err != nil || buttonNumber < 0 || buttonNumber >= len(buttons) {
+			return fmt.Errorf("buttonActions: invalid button number %s", k)
+		}
+		action := fmt.Sprint(v)
+		if _, ok := actionNames[strings.SplitN(action, ":", 2)[0]]; !ok {
+			return fmt.Errorf("buttonActions: %w: %s", errUnknownAction, action)
+		}
+		buttons[buttonNumber] = map[string]interface{}{"action": action}
+	}
+	settings["profiles"] = []interface{}{p}
+	return nil
+}
+
+// backupFile returns the name of the backup file for a config file of the given version. Existing backups are kept
+func backupFile(file string, version int) string {
+	backup := fmt.Sprintf("%s.v%d.bak", file, version)
+	if _, err := os.Stat(backup); errors.Is(err, fs.ErrNotExist) {
+		return backup
+	}
+	return fmt.Sprintf("%s.v%d.%s.bak", file, version, time.Now().Format("20060102-150405"))
+}
+
+// migrateSettings upgrades the content of a config file to currentConfigVersion by applying all migrations from its
+// version on. It returns the migrated content and the version of data. Content of the current version is returned
+// unchanged, comments of migrated content are lost
+func migrateSettings(data []byte, override bool) ([]byte, int, error) {
+	settings := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, 0, err
+	}
+	version, err := configVersion(settings)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > currentConfigVersion {
+		return nil, 0, fmt.Errorf("%w: version %d", errConfigTooNew, version)
+	}
+	if version == currentConfigVersion {
+		return data, version, nil
+	}
+
+	for v := version + 1; v <= currentConfigVersion; v++ {
+		if err := configMigrations[v](settings, override); err != nil {
+			return nil, 0, fmt.Errorf("migration to config version %d: %w", v, err)
+		}
+	}
+	if key, found := settingsKey(settings, "configVersion"); found {
+		delete(settings, key)
+	}
+	settings["configVersion"] = currentConfigVersion
+	migrated, err := yaml.Marshal(settings)
+	if err != nil {
+		return nil, 0, err
+	}
+	return migrated, version, nil
+}
+
+// migrateConfigFiles upgrades the config files owned by the user to currentConfigVersion: the config file if there
+// are no override files, otherwise only the override files. Like for writeConfig a config file with override files
+// may be shared, e.g. by a team, so it's left untouched and only migrated in memory by readConfigSources
+func migrateConfigFiles(file string) error {
+	overrides := []string{}
+	for _, v := range overrideFiles(file) {
+		if _, err := os.Stat(v); err == nil {
+			overrides = append(overrides, v)
+		}
+	}
+	if len(overrides) == 0 {
+		return migrateConfig(file, false)
+	}
+	for _, v := range overrides {
+		if err := migrateConfig(v, true); err != nil {
+			return fmt.Errorf("%s: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// migrateConfig upgrades a config file or override file to currentConfigVersion (see migrateSettings). The original
+// file is kept as backup, including its comments
+func migrateConfig(file string, override bool) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	migrated, version, err := migrateSettings(data, override)
+	if err != nil || version == currentConfigVersion {
+		return err
+	}
+
+	backup := backupFile(file, version)
+	if err := os.WriteFile(backup, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, migrated, 0o644); err != nil {
+		return err
+	}
+	slog.Info("config: migrated", "file", file, "from", version, "to", currentConfigVersion, "backup", backup)
+	return nil
+}
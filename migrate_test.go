@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// copyFixture copies the file of testdata to dir using the name file and returns its path
+func copyFixture(t *testing.T, fixture string, dir string, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// assertYAML fails if the file doesn't contain the same settings as the fixture, ignoring formatting and comments
+func assertYAML(t *testing.T, file string, fixture string) {
+	t.Helper()
+	var got, want interface{}
+	for _, v := range []struct {
+		file   string
+		result *interface{}
+	}{{file, &got}, {filepath.Join("testdata", fixture), &want}} {
+		data, err := os.ReadFile(v.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := yaml.Unmarshal(data, v.result); err != nil {
+			t.Fatalf("%s: %v", v.file, err)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		data, _ := os.ReadFile(file)
+		t.Errorf("%s differs from %s:\n%s", file, fixture, data)
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		override bool
+		want     string
+	}{
+		{"built-in profile with button actions", "config.v1.yaml", false, "config.v2.yaml"},
+		{"profiles ignoring button actions", "config.v1.profiles.yaml", false, "config.v2.profiles.yaml"},
+		{"override file", "config.v1.local.yaml", true, "config.v2.local.yaml"},
+		{"override file with button actions", "config.v1.actions.local.yaml", true, "config.v2.actions.local.yaml"},
+		{"override file with profiles", "config.v1.profiles.local.yaml", true, "config.v2.profiles.local.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := copyFixture(t, tt.fixture, t.TempDir(), "config.yaml")
+			if err := migrateConfig(file, tt.override); err != nil {
+				t.Fatal(err)
+			}
+			assertYAML(t, file, tt.want)
+			assertYAML(t, file+".v1.bak", tt.fixture)
+		})
+	}
+}
+
+func TestMigrateConfigCurrentVersion(t *testing.T) {
+	dir := t.TempDir()
+	file := copyFixture(t, "config.v2.yaml", dir, "config.yaml")
+	original, _ := os.ReadFile(file)
+	if err := migrateConfig(file, false); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != string(original) {
+		t.Error("config file of the current version was changed")
+	}
+	if backups, _ := filepath.Glob(filepath.Join(dir, "*.bak")); len(backups) > 0 {
+		t.Errorf("unexpected backups %v", backups)
+	}
+}
+
+func TestMigrateConfigTooNew(t *testing.T) {
+	file := copyFixture(t, "config.v3.yaml", t.TempDir(), "config.yaml")
+	if err := migrateConfig(file, false); !errors.Is(err, errConfigTooNew) {
+		t.Errorf("got %v, want %v", err, errConfigTooNew)
+	}
+}
+
+func TestMigrateConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	shared := copyFixture(t, "config.v1.yaml", dir, "config.yaml")
+	local := copyFixture(t, "config.v1.local.yaml", dir, "config.local.yaml")
+	if err := migrateConfigFiles(shared); err != nil {
+		t.Fatal(err)
+	}
+	assertYAML(t, shared, "config.v1.yaml") // shared with override files, left untouched
+	assertYAML(t, local, "config.v2.local.yaml")
+
+	sources, err := readConfigSources(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated := filepath.Join(dir, "migrated.yaml")
+	if err := os.WriteFile(migrated, sources[0].data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assertYAML(t, migrated, "config.v2.yaml") // migrated in memory
+}
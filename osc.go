@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	oscRecallAddress = "/shuttlemidi/snapshot/recall" // recalls the snapshot named by the string argument
+	oscMaxPacketSize = 65536
+)
+
+var errInvalidOSCMessage = errors.New("invalid OSC message")
+
+// oscString returns the OSC encoding of s: null terminated and padded to a multiple of four bytes
+func oscString(s string) []byte {
+	b := append([]byte(s), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// oscMessage returns the OSC encoding of a message. Arguments can be float32, int32 or string values
+func oscMessage(address string, args ...interface{}) []byte {
+	tags := ","
+	data := []byte{}
+	for _, v := range args {
+		switch arg := v.(type) {
+		case float32:
+			tags += "f"
+			data = binary.BigEndian.AppendUint32(data, math.Float32bits(arg))
+		case int32:
+			tags += "i"
+			data = binary.BigEndian.AppendUint32(data, uint32(arg))
+		case string:
+			tags += "s"
+			data = append(data, oscString(arg)...)
+		default:
+			panic(fmt.Sprintf("unsupported OSC argument %T", v))
+		}
+	}
+	msg := oscString(address)
+	msg = append(msg, oscString(tags)...)
+	return append(msg, data...)
+}
+
+// readOSCString returns the OSC string at the start of data and the data following it
+func readOSCString(data []byte) (string, []byte, error) {
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", nil, errInvalidOSCMessage
+	}
+	size := (end + 4) &^ 3
+	if size > len(data) {
+		return "", nil, errInvalidOSCMessage
+	}
+	return string(data[:end]), data[size:], nil
+}
+
+// parseOSCMessage decodes an OSC message with float32, int32 or string arguments
+func parseOSCMessage(data []byte) (string, []interface{}, error) {
+	address, data, err := readOSCString(data)
+	if err != nil || len(address) == 0 || address[0] != '/' {
+		return "", nil, errInvalidOSCMessage
+	}
+	args := []interface{}{}
+	if len(data) == 0 { // message without type tags
+		return address, args, nil
+	}
+	tags, data, err := readOSCString(data)
+	if err != nil || len(tags) == 0 || tags[0] != ',' {
+		return "", nil, errInvalidOSCMessage
+	}
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'f', 'i':
+			if len(data) < 4 {
+				return "", nil, errInvalidOSCMessage
+			}
+			value := binary.BigEndian.Uint32(data)
+			data = data[4:]
+			if tag == 'f' {
+				args = append(args, math.Float32frombits(value))
+			} else {
+				args = append(args, int32(value))
+			}
+		case 's':
+			var s string
+			if s, data, err = readOSCString(data); err != nil {
+				return "", nil, err
+			}
+			args = append(args, s)
+		default:
+			return "", nil, fmt.Errorf("%w: unsupported type tag %q", errInvalidOSCMessage, tag)
+		}
+	}
+	return address, args, nil
+}
+
+// sendOSCTo sends an OSC message via UDP to target (host:port)
+func sendOSCTo(target string, address string, args ...interface{}) error {
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(oscMessage(address, args...))
+	return err
+}
+
+// sendOSC sends an OSC message with a single float argument via UDP to the host configured by 'oscTarget'
+func sendOSC(address string, value float32) error {
+	return sendOSCTo(viper.GetString("oscTarget"), address, value)
+}
+
+// listenOSC receives the OSC messages sent to conn and handles them until quitCh is closed, which closes conn
+func listenOSC(conn net.PacketConn, quitCh chan struct{}) {
+	go func() {
+		<-quitCh
+		conn.Close()
+	}()
+	buf := make([]byte, oscMaxPacketSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("osc: can't receive", "err", err)
+			continue
+		}
+		address, args, err := parseOSCMessage(buf[:n])
+		if err != nil {
+			slog.Warn("osc: message ignored", "from", from, "err", err)
+			continue
+		}
+		handleOSC(address, args)
+	}
+}
+
+// handleOSC executes a received OSC message, the changes are applied by the event loop
+func handleOSC(address string, args []interface{}) {
+	switch address {
+	case oscRecallAddress:
+		name, ok := "", len(args) == 1
+		if ok {
+			name, ok = args[0].(string)
+		}
+		if !ok {
+			slog.Warn("osc: recall needs the snapshot name as the only argument", "args", args)
+			return
+		}
+		if !requestRecall(name) {
+			slog.Error("osc: snapshot not recalled, the event loop is busy", "name", name)
+		}
+	default:
+		slog.Warn("osc: unknown address", "address", address)
+	}
+}
+
+// startOSCListener listens for OSC messages on the address configured by 'oscListen' until quitCh is closed. The
+// setting is read once at startup, "" disables remote control
+func startOSCListener(quitCh chan struct{}) {
+	address := viper.GetString("oscListen")
+	if address == "" {
+		return
+	}
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		slog.Error("osc: can't listen", "address", address, "err", err)
+		return
+	}
+	slog.Info("osc: listening", "address", address)
+	go listenOSC(conn, quitCh)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseOSCMessage(t *testing.T) {
+	address, args, err := parseOSCMessage(oscMessage("/cue/1", float32(0.5), int32(-3), "Reference", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{float32(0.5), int32(-3), "Reference", ""}; address != "/cue/1" ||
+		!reflect.DeepEqual(args, want) {
+		t.Errorf("parseOSCMessage() = %q, %v, want %q, %v", address, args, "/cue/1", want)
+	}
+
+	invalid := map[string][]byte{
+		"no address":         oscString("cue"),
+		"unterminated":       []byte("/cue"),
+		"missing tag comma":  append(oscString("/cue"), oscString("f")...),
+		"missing argument":   append(oscString("/cue"), oscString(",f")...),
+		"unsupported tag":    append(oscString("/cue"), oscString(",b")...),
+		"truncated string":   append(append(oscString("/cue"), oscString(",s")...), 'a'),
+		"truncated argument": append(append(oscString("/cue"), oscString(",i")...), 0, 0),
+	}
+	for name, data := range invalid {
+		if _, _, err := parseOSCMessage(data); !errors.Is(err, errInvalidOSCMessage) {
+			t.Errorf("%s: got %v, want %v", name, err, errInvalidOSCMessage)
+		}
+	}
+}
+
+// recordingController records the CCs sent by the event loop
+type recordingController struct {
+	ccs chan [2]uint8
+}
+
+func (c *recordingController) open() error  { return nil }
+func (c *recordingController) close() error { return nil }
+
+func (c *recordingController) sendCommand(controller uint8, value uint8, repeat bool) error {
+	c.ccs <- [2]uint8{controller, value}
+	return nil
+}
+
+func (c *recordingController) sendNote(key uint8, on bool) error { return nil }
+
+func TestListenOSCRecall(t *testing.T) {
+	previousControl, previousSnapshots := mControl, snapshots
+	t.Cleanup(func() {
+		mControl, snapshots = previousControl, previousSnapshots
+		viper.Reset()
+		updateTimerSettings()
+	})
+	profiles, cues = nil, nil
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	if err := loadBuiltinConfig(); err != nil {
+		t.Fatal(err)
+	}
+	controller := &recordingController{ccs: make(chan [2]uint8, 10)}
+	mControl = controller
+	snapshots = []*stateSnapshot{{name: "Reference", ccs: map[uint8]uint8{20: 64}}}
+	snapshotCCs = map[uint8]uint8{}
+
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	go func() { // the event loop
+		for {
+			select {
+			case <-quitCh:
+				return
+			case f := <-requestCh:
+				f()
+			}
+		}
+	}()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go listenOSC(conn, quitCh)
+
+	for _, v := range []struct {
+		address string
+		args    []interface{}
+	}{
+		{"/unknown", nil},
+		{oscRecallAddress, nil},
+		{oscRecallAddress, []interface{}{"Missing"}},
+		{oscRecallAddress, []interface{}{"Reference"}},
+	} {
+		if err := sendOSCTo(conn.LocalAddr().String(), v.address, v.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case cc := <-controller.ccs:
+		if cc != [2]uint8{20, 64} {
+			t.Errorf("sent CC %v, want [20 64]", cc)
+		}
+	case <-time.After(time.Second):
+		t.Error("snapshot not recalled")
+	}
+}
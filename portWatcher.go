@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"fyne.io/systray"
+	"github.com/spf13/viper"
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/rtmididrv"
+)
+
+// portState returns the text shown in the tray status for a MIDI port
+func portState(connected bool) string {
+	if connected {
+		return "connected"
+	}
+	return "not connected"
+}
+
+// showPortStatus shows the connection health of the MIDI ports in the tray status item and the tooltip
+func showPortStatus(statusItem *systray.MenuItem, controlOK bool, displayOK bool) {
+	display := portState(displayOK)
+	if !viper.GetBool("useDisplay") {
+		display = "off"
+	}
+	statusItem.SetTitle(fmt.Sprintf("Control: %s, Display: %s", portState(controlOK), display))
+	if controlOK && (displayOK || !viper.GetBool("useDisplay")) {
+		systray.SetTooltip(applicationName)
+	} else {
+		systray.SetTooltip(applicationName + " - MIDI device not connected")
+	}
+}
+
+// resendButtonStates sends the state of all latching buttons, so the MIDI target matches the controller again after
+// it was disconnected
+func resendButtonStates(midiController midiController) {
+	for i, b := range activeProfile.buttons {
+		if !b.latch || b.action != actionNone {
+			continue
+		}
+		if b.state {
+			sendButtonCC(midiController, i, CCvalueOn)
+		} else {
+			sendButtonCC(midiController, i, CCvalueOff)
+		}
+	}
+}
+
+// watchMIDIPorts periodically enumerates the MIDI ports and lets the event loop check them by checkMIDIPorts. The
+// connection health is shown in the tray by statusItem. A single driver is used for all enumerations, as creating one
+// each poll is expensive. The goroutine is stopped by closing quitCh
+func watchMIDIPorts(statusItem *systray.MenuItem, quitCh chan struct{}) {
+	tick := time.NewTicker(portPollInterval * time.Millisecond)
+	defer tick.Stop()
+	var driver midi.Driver // nil: a driver is created for each enumeration
+	if drv, err := rtmididrv.New(); err != nil {
+		slog.Error("midi: can't create the driver enumerating the ports", "err", err)
+	} else {
+		driver = drv
+		defer drv.Close()
+	}
+
+	requestEvent(func() { showPortStatus(statusItem, controlConnected, displayPortFound()) })
+	for {
+		select {
+		case <-quitCh:
+			return
+		case <-tick.C:
+			if ports, ok := midiPorts(driver); ok { // enumerated outside of the event loop, it takes a while
+				requestEvent(func() { checkMIDIPorts(ports, statusItem, quitCh) })
+			}
+		}
+	}
+}
+
+// checkDisplayPort resolves the display port among ports again. If it changed, the display is set up again and
+// refreshed if the port was found. It runs within the event loop
+func checkDisplayPort(ports []string) {
+	if !updateDisplayPort(ports) {
+		return
+	}
+	updateDisplay()
+	if displayPortFound() {
+		refreshDisplay(currentDisplay())
+	}
+}
+
+// checkMIDIPorts updates the MIDI device sub menus with the ports found. A lost control port is reopened once it
+// reappears and the current state is sent again, a reappearing display is refreshed. Failures to reopen are only
+// logged. It runs within the event loop
+func checkMIDIPorts(ports []string, statusItem *systray.MenuItem, menuExit chan struct{}) {
+	updateMIDIMenus(ports, menuExit)
+
+	controlFound, _ := findMIDIPorts(profileMidiDevice(), ports)
+	switch {
+	case len(controlFound) > 0 && !controlConnected:
+		slog.Info("midi: control port available, reconnecting", "device", profileMidiDevice())
+		openControl(profileMidiDevice(), false)
+		if controlConnected {
+			resendButtonStates(mControl)
+		}
+	case len(controlFound) == 0 && controlConnected:
+		slog.Warn("midi: control port lost", "device", profileMidiDevice())
+		controlConnected = false
+	}
+
+	checkDisplayPort(ports)
+	showPortStatus(statusItem, controlConnected, displayPortFound())
+}
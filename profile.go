@@ -0,0 +1,379 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"fyne.io/systray"
+	"github.com/spf13/viper"
+)
+
+// profile is a named mapping of all ShuttlePro controls and the MIDI target they are sent to
+type profile struct {
+	name       string
+	midiDevice string // control MIDI device, empty = controlMidiDevice
+	channel    uint8  // MIDI channel (0-15)
+	monitor    bool   // monitor controller behaviour: speaker/headphone buttons and volume dial
+	buttons    [15]button
+	wheelCCs   [2]uint8 // midi CC numbers for right and left wheel positions
+	dialCC     uint8    // midi CC number for relative dial steps if the profile is no monitor profile
+}
+
+// profileConfig is the representation of a profile in the config file
+type profileConfig struct {
+	Name       string         `mapstructure:"name"`
+	MidiDevice string         `mapstructure:"midiDevice"`
+	Channel    uint8          `mapstructure:"channel"`
+	Monitor    bool           `mapstructure:"monitor"`
+	Buttons    []buttonConfig `mapstructure:"buttons"`
+	WheelCCs   []uint8        `mapstructure:"wheelCCs"`
+	DialCC     uint8          `mapstructure:"dialCC"`
+}
+
+// buttonConfig is the representation of a button in the config file
+type buttonConfig struct {
+	State      bool   `mapstructure:"state"`
+	CC         uint8  `mapstructure:"cc"`
+	Note       bool   `mapstructure:"note"`
+	Latch      bool   `mapstructure:"latch"`
+	MsgOn      string `mapstructure:"msgOn"`
+	MsgOff     string `mapstructure:"msgOff"`
+	LCDchannel uint8  `mapstructure:"lcdChannel"`
+	LCDrow     string `mapstructure:"lcdRow"` // "upper" or "lower"
+	Action     string `mapstructure:"action"` // e.g. "talkback" or "snapshot:<name>"
+	ColorOn    string `mapstructure:"colorOn"`
+	ColorOff   string `mapstructure:"colorOff"`
+	Blink      string `mapstructure:"blink"` // "text", "color" or "both"
+	LED        *uint8 `mapstructure:"led"`   // MCU note number of the button LED
+	LEDOn      string `mapstructure:"ledOn"` // "off", "on" or "blink"
+	LEDOff     string `mapstructure:"ledOff"`
+}
+
+var (
+	errUnknownAction = errors.New("unknown action")
+
+	// profiles contains all mapping profiles, activeProfile the one currently used
+	profiles      []*profile
+	activeProfile *profile
+	// mProfileItems are the tray menu items of the profiles, in the same order as profiles
+	mProfileItems []*systray.MenuItem
+	// profileMenuExit stops the goroutines of the current profile menu items
+	profileMenuExit chan struct{}
+)
+
+// actionButton returns the button definition for an action as used in the config file, e.g. "snapshot:Mixing"
+func actionButton(value string) (button, error) {
+	name, arg, _ := strings.Cut(value, ":")
+	action, ok := actionNames[name]
+	if !ok {
+		return button{}, fmt.Errorf("%w: %s", errUnknownAction, value)
+	}
+	switch action {
+	case actionTalkback:
+		return talkbackButton(), nil
+	case actionSelectCue:
+		return selectCueButton(), nil
+	case actionABCompare:
+		return abCompareButton(), nil
+	case actionSnapshot:
+		return snapshotButton(arg), nil
+	case actionCycleProfile:
+		return cycleProfileButton(), nil
+	case actionNextPage:
+		return nextPageButton(), nil
+	}
+	return button{}, fmt.Errorf("%w: %s", errUnknownAction, value)
+}
+
+// actionValue returns the action of the button as used in the config file, e.g. "snapshot:Mixing"
+func actionValue(b button) string {
+	for k, v := range actionNames {
+		if v != b.action {
+			continue
+		}
+		if b.arg != "" {
+			return k + ":" + b.arg
+		}
+		return k
+	}
+	return ""
+}
+
+// builtinProfile returns the monitor profile used without profiles in the config file
+func builtinProfile() *profile {
+	return &profile{name: "Monitor", monitor: true, buttons: defaultButtons, wheelCCs: [2]uint8{0, 1}}
+}
+
+// defaultProfile returns the built-in monitor profile with the actions of the config key 'buttonActions' (used by
+// config files before version 2) applied
+func defaultProfile() *profile {
+	p := builtinProfile()
+	for k, v := range viper.GetStringMapString("buttonActions") {
+		buttonNumber, err := strconv.Atoi(k)
+		if err != nil || buttonNumber < 0 || buttonNumber >= len(p.buttons) {
+			slog.Error("config: invalid button number in buttonActions", "button", k)
+			continue
+		}
+		b, err := actionButton(v)
+		if err != nil {
+			slog.Error("config: invalid action in buttonActions", "button", k, "err", err)
+			continue
+		}
+		p.buttons[buttonNumber] = b
+	}
+	return p
+}
+
+// config returns the representation of the profile written to the config file
+func (p *profile) config() map[string]interface{} {
+	buttons := make([]map[string]interface{}, 0, len(p.buttons))
+	for _, b := range p.buttons {
+		buttons = append(buttons, b.config())
+	}
+	cfg := map[string]interface{}{
+		"name":     p.name,
+		"channel":  p.channel,
+		"monitor":  p.monitor,
+		"buttons":  buttons,
+		"wheelCCs": []uint8{p.wheelCCs[0], p.wheelCCs[1]},
+	}
+	if p.midiDevice != "" {
+		cfg["midiDevice"] = p.midiDevice
+	}
+	if !p.monitor {
+		cfg["dialCC"] = p.dialCC
+	}
+	return cfg
+}
+
+// config returns the representation of the button written to the config file
+func (b button) config() map[string]interface{} {
+	cfg := map[string]interface{}{"action": actionValue(b)}
+	if b.action == actionNone {
+		row := "upper"
+		if b.LCDrow == lowerRow {
+			row = "lower"
+		}
+		cfg = map[string]interface{}{
+			"state":      b.state,
+			"cc":         b.cc,
+			"note":       b.note,
+			"latch":      b.latch,
+			"msgOn":      b.msgOn,
+			"msgOff":     b.msgOff,
+			"lcdChannel": b.LCDchannel,
+			"lcdRow":     row,
+		}
+	}
+	if b.colorOn != "" {
+		cfg["colorOn"] = b.colorOn
+	}
+	if b.colorOff != "" {
+		cfg["colorOff"] = b.colorOff
+	}
+	if b.blink != "" {
+		cfg["blink"] = b.blink
+	}
+	if b.hasLED {
+		cfg["led"] = b.led
+		if b.ledOn != "" {
+			cfg["ledOn"] = b.ledOn
+		}
+		if b.ledOff != "" {
+			cfg["ledOff"] = b.ledOff
+		}
+	}
+	return cfg
+}
+
+// newProfile converts the config representation into a profile. Buttons missing in the config are left unmapped
+func newProfile(cfg profileConfig) (*profile, error) {
+	p := &profile{name: cfg.Name, midiDevice: cfg.MidiDevice, channel: cfg.Channel, monitor: cfg.Monitor, dialCC: cfg.DialCC,
+		wheelCCs: [2]uint8{0, 1}}
+	copy(p.wheelCCs[:], cfg.WheelCCs)
+	if len(cfg.Buttons) > len(p.buttons) {
+		return nil, fmt.Errorf("profile %s: too many buttons (%d)", cfg.Name, len(cfg.Buttons))
+	}
+	for i, v := range cfg.Buttons {
+		if v.Action != "" {
+			b, err := actionButton(v.Action)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s, button %d: %w", cfg.Name, i, err)
+			}
+			b.colorOn, b.colorOff, b.blink = v.ColorOn, v.ColorOff, v.Blink
+			b.setLED(v)
+			p.buttons[i] = b
+			continue
+		}
+		row := uint8(upperRow)
+		if v.LCDrow == "lower" {
+			row = lowerRow
+		}
+		p.buttons[i] = button{state: v.State, cc: v.CC, note: v.Note, latch: v.Latch, msgOn: v.MsgOn, msgOff: v.MsgOff,
+			LCDchannel: v.LCDchannel, LCDrow: row, colorOn: v.ColorOn, colorOff: v.ColorOff,
+			blink: v.Blink}
+		p.buttons[i].setLED(v)
+	}
+	return p, nil
+}
+
+// setLED sets the LED of the button from its config representation
+func (b *button) setLED(cfg buttonConfig) {
+	if cfg.LED != nil {
+		b.hasLED, b.led, b.ledOn, b.ledOff = true, *cfg.LED, cfg.LEDOn, cfg.LEDOff
+	}
+}
+
+// readProfiles reads the profiles from the config key 'profiles'. Without profiles in the config the built-in
+// monitor profile is used. The profile named by 'activeProfile' is returned as the active one
+func readProfiles() ([]*profile, *profile, error) {
+	var cfg []profileConfig
+	if err := viper.UnmarshalKey("profiles", &cfg); err != nil {
+		return nil, nil, err
+	}
+	result := make([]*profile, 0, len(cfg))
+	for _, v := range cfg {
+		p, err := newProfile(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, p)
+	}
+	if len(result) == 0 {
+		result = append(result, defaultProfile())
+	}
+
+	active := result[0]
+	for _, v := range result {
+		if v.name == viper.GetString("activeProfile") {
+			active = v
+		}
+	}
+	return result, active, nil
+}
+
+// profileMidiDevice returns the control MIDI device of the active profile
+func profileMidiDevice() string {
+	if activeProfile.midiDevice != "" {
+		return activeProfile.midiDevice
+	}
+	return viper.GetString("controlMidiDevice")
+}
+
+// switchProfile activates the profile with the given index, reopens the MIDI device with its MIDI target and shows
+// its name on the display. It runs within the event loop, which keeps running, so the release of buttons still held
+// (e.g. the profile chord) is handled by the same loop and sent to the new device. With showError set a failure to
+// open the MIDI device is shown in a dialog, otherwise only logged. With persist set the selection is written to the
+// config file. Otherwise the setting is left alone, so it isn't saved along with other settings either, e.g. for a
+// switch by the focus rules
+func switchProfile(index int, showError bool, persist bool) {
+	if index < 0 || index >= len(profiles) {
+		return
+	}
+	activeProfile = profiles[index]
+	slog.Info("profile selected", "profile", activeProfile.name)
+	if persist {
+		viper.Set("activeProfile", activeProfile.name)
+		writeConfig("activeProfile")
+	}
+
+	for i, v := range mProfileItems {
+		setChecked(v, i == index)
+	}
+	updateMIDIChecks()
+	openControl(profileMidiDevice(), showError)
+	showProfileName()
+}
+
+// buildProfileMenu (re)creates the sub menu items of the profiles menu, each handled by its own goroutine passing the
+// selection to the event loop. Items of a previous build are hidden and their goroutines stopped
+func buildProfileMenu(menu *systray.MenuItem, menuExit chan struct{}) {
+	if profileMenuExit != nil {
+		close(profileMenuExit)
+	}
+	for _, v := range mProfileItems {
+		v.Hide()
+	}
+	profileMenuExit = make(chan struct{})
+	itemsExit := profileMenuExit
+
+	mProfileItems = make([]*systray.MenuItem, 0, len(profiles))
+	for i, v := range profiles {
+		mProfileItem := menu.AddSubMenuItemCheckbox(v.name, "", v == activeProfile)
+		mProfileItems = append(mProfileItems, mProfileItem)
+		index := i
+
+		// a go routine for every profile menu item
+		go func() {
+			for {
+				select {
+				case <-mProfileItem.ClickedCh:
+					requestEvent(func() { switchProfile(index, true, true) })
+				case <-itemsExit:
+					return
+				case <-menuExit:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// cycleProfile activates the profile following the active one. It is called by the event loop for the profile chord
+// and buttons mapped to cycleProfile
+func cycleProfile() {
+	for i, v := range profiles {
+		if v == activeProfile {
+			switchProfile((i+1)%len(profiles), true, true)
+			return
+		}
+	}
+}
+
+// showProfileName displays the name of the active profile at the profile cell of the display
+func showProfileName() {
+	showStatus(activeProfile.name)
+}
+
+// cycleProfileButton returns the button definition used for a button mapped to the cycleProfile action
+func cycleProfileButton() button {
+	return button{
+		latch:  false,
+		action: actionCycleProfile,
+	}
+}
+
+// profileChord returns the buttons of the config key 'profileChord'. Pressing all of them together cycles the profiles
+func profileChord() map[int]bool {
+	chord := map[int]bool{}
+	for _, v := range viper.GetIntSlice("profileChord") {
+		chord[v] = true
+	}
+	return chord
+}
+
+// chordPressed reports if all buttons of the chord are pressed
+func chordPressed(chord map[int]bool, pressed []bool) bool {
+	if len(chord) == 0 {
+		return false
+	}
+	for k := range chord {
+		if k < 0 || k >= len(pressed) || !pressed[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// chordPartlyPressed reports if any button of the chord is still pressed
+func chordPartlyPressed(chord map[int]bool, pressed []bool) bool {
+	for k := range chord {
+		if k >= 0 && k < len(pressed) && pressed[k] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configSource is the content of a config file
+type configSource struct {
+	file string
+	data []byte
+}
+
+var (
+	// configPath is the config file given by the --config flag or the environment variable configPathEnv
+	configPath string
+	// configFile is the config file in use. Override files next to it are merged on top of it
+	configFile string
+	// lastGoodConfig is the content of the config files that were loaded last without errors. It's nil while the
+	// built-in config is used because the config files were invalid at startup
+	lastGoodConfig []configSource
+	// lastConfigHash is the hash of the config files content that was handled last, either loaded or rejected
+	lastConfigHash   [sha256.Size]byte
+	errBuiltinConfig = errors.New("using the built-in config")
+
+	// trayUpdate updates the tray menu after the config file was reloaded. It is set once the menu exists
+	trayUpdate func()
+)
+
+// defaultConfigFile returns the config file in $XDG_CONFIG_HOME (default: $HOME/.config). A file in $HOME/.config
+// used by previous versions is preferred if the XDG location doesn't contain one
+func defaultConfigFile() string {
+	home, _ := os.UserHomeDir()
+	legacy := filepath.Join(home, ".config", configName+".yaml")
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" || !filepath.IsAbs(dir) { // relative paths are invalid according to the XDG spec
+		return legacy
+	}
+	file := filepath.Join(dir, configName+".yaml")
+	if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	return file
+}
+
+// resolveConfigFile returns the config file given by --config or the environment, else the default one
+func resolveConfigFile() string {
+	if configPath != "" {
+		return configPath
+	}
+	if file := os.Getenv(configPathEnv); file != "" {
+		return file
+	}
+	return defaultConfigFile()
+}
+
+// overrideFiles returns the possible override files of a config file in the order they are merged:
+// <name>.<hostname>.yaml and <name>.local.yaml in the same directory
+func overrideFiles(file string) []string {
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	result := []string{}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		host, _, _ = strings.Cut(host, ".")
+		result = append(result, base+"."+host+".yaml")
+	}
+	return append(result, base+".local.yaml")
+}
+
+// readConfigSources reads the config file and all existing override files. Files of an older version are migrated in
+// memory, e.g. a shared config file not migrated by migrateConfigFiles
+func readConfigSources(file string) ([]configSource, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if data, _, err = migrateSettings(data, false); err != nil {
+		return nil, errors.Join(errors.New(file), err)
+	}
+	sources := []configSource{{file: file, data: data}}
+	for _, v := range overrideFiles(file) {
+		data, err := os.ReadFile(v)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if data, _, err = migrateSettings(data, true); err != nil {
+			return nil, errors.Join(errors.New(v), err)
+		}
+		sources = append(sources, configSource{file: v, data: data})
+	}
+	return sources, nil
+}
+
+// sourceFiles returns the file names of the sources
+func sourceFiles(sources []configSource) []string {
+	result := make([]string, 0, len(sources))
+	for _, v := range sources {
+		result = append(result, v.file)
+	}
+	return result
+}
+
+// hashSources returns a hash over the names and contents of all sources
+func hashSources(sources []configSource) [sha256.Size]byte {
+	h := sha256.New()
+	for _, v := range sources {
+		h.Write([]byte(v.file))
+		h.Write([]byte{0})
+		h.Write(v.data)
+		h.Write([]byte{0})
+	}
+	var result [sha256.Size]byte
+	copy(result[:], h.Sum(nil))
+	return result
+}
+
+// applyConfigSources replaces the config of v by the first source and merges the others on top of it
+func applyConfigSources(v *viper.Viper, sources []configSource) error {
+	for i, source := range sources {
+		var err error
+		if i == 0 {
+			err = v.ReadConfig(bytes.NewReader(source.data))
+		} else {
+			err = v.MergeConfig(bytes.NewReader(source.data))
+		}
+		if err != nil {
+			return errors.Join(errors.New(source.file), err)
+		}
+	}
+	return nil
+}
+
+// applySettings replaces the global settings by the defaults and the contents of the config files. Values set at
+// runtime by viper.Set are dropped as well, they would win over the files forever otherwise. They aren't lost,
+// writeConfig stores them in the files right after setting them
+func applySettings(sources []configSource) error {
+	viper.Reset()
+	for k, v := range configDefaults {
+		viper.SetDefault(k, v)
+	}
+	viper.SetConfigType("yaml")
+	viper.SetConfigFile(configFile)
+	defer updateTimerSettings()
+	return applyConfigSources(viper.GetViper(), sources)
+}
+
+// readSettings returns the settings of the config file used by ShuttleMidi without changing the global settings or
+// any file, e.g. for commands run next to the tray application. A missing default config file gives the defaults
+func readSettings() (*viper.Viper, error) {
+	file := resolveConfigFile()
+	sources, err := readConfigSources(file)
+	if errors.Is(err, fs.ErrNotExist) && file == defaultConfigFile() {
+		sources, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newSettings(sources)
+}
+
+// newSettings returns a settings instance with the defaults applied, read from the contents of the config files
+func newSettings(sources []configSource) (*viper.Viper, error) {
+	v := viper.New()
+	for k, value := range configDefaults {
+		v.SetDefault(k, value)
+	}
+	v.SetConfigType("yaml")
+	if err := applyConfigSources(v, sources); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// loadConfig validates the settings and reads the profiles, cues, A/B states and snapshots from them. sources are
+// the config files, used for line numbers of the problems found. Nothing is changed if any part is invalid. The
+// runtime state (button states and cue volumes) of profiles and cues that still exist is kept
+func loadConfig(sources []configSource) error {
+	if errs := validateConfig(viper.GetViper(), sources); len(errs) > 0 {
+		logConfigErrors(errs)
+		return joinConfigErrors(errs)
+	}
+	newProfiles, newActive, err := readProfiles()
+	if err != nil {
+		return err
+	}
+	newCues, err := readCues()
+	if err != nil {
+		return err
+	}
+	newABStates, err := readABCompare()
+	if err != nil {
+		return err
+	}
+	newSnapshots, err := readSnapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range newProfiles {
+		for _, old := range profiles {
+			if old.name != p.name {
+				continue
+			}
+			for i := range p.buttons {
+				if p.buttons[i].latch && p.buttons[i].action == actionNone && old.buttons[i].latch {
+					p.buttons[i].state = old.buttons[i].state
+				}
+			}
+		}
+	}
+	for i := range newCues {
+		for _, old := range cues {
+			if old.name == newCues[i].name {
+				newCues[i].volume = old.volume
+			}
+		}
+	}
+
+	profiles, activeProfile = newProfiles, newActive
+	cues = newCues
+	abStates = newABStates
+	snapshots = newSnapshots
+	if selectedCue >= len(cues) {
+		selectedCue = -1
+	}
+	return nil
+}
+
+// loadBuiltinConfig replaces the settings, profiles, cues, A/B states and snapshots by the built-in defaults. It's used
+// if the config files are invalid at startup. Once they are fixed, they are loaded by reloadConfig
+func loadBuiltinConfig() error {
+	lastGoodConfig = nil
+	if err := applySettings(nil); err != nil {
+		return err
+	}
+	return loadConfig(nil)
+}
+
+// rememberConfig stores the content of the config files as the last one loaded without errors
+func rememberConfig() {
+	sources, err := readConfigSources(configFile)
+	if err != nil {
+		slog.Error("config: can't read config file", "err", err)
+		return
+	}
+	lastGoodConfig = sources
+	lastConfigHash = hashSources(sources)
+}
+
+// writeConfig stores the settings changed by ShuttleMidi. Without override files all settings are written to the
+// config file. Otherwise only the given keys are written to the last override file, so a shared config file stays
+// untouched. The file change caused by this is not reloaded. Nothing is written while the built-in config is used,
+// so the invalid config files aren't replaced
+func writeConfig(keys ...string) error {
+	if lastGoodConfig == nil {
+		slog.Warn("config: using the built-in config, settings not saved", "keys", keys)
+		return errBuiltinConfig
+	}
+	if len(lastGoodConfig) < 2 { // no override files
+		if err := viper.WriteConfig(); err != nil {
+			slog.Error("viper: can't save config", "err", err)
+			return err
+		}
+		rememberConfig()
+		return nil
+	}
+
+	target := lastGoodConfig[len(lastGoodConfig)-1]
+	settings := map[string]interface{}{}
+	if err := yaml.Unmarshal(target.data, &settings); err != nil {
+		slog.Error("viper: can't save config", "file", target.file, "err", err)
+		return err
+	}
+	for _, key := range keys {
+		for k := range settings {
+			if strings.EqualFold(k, key) {
+				delete(settings, k)
+			}
+		}
+		settings[key] = viper.Get(key)
+	}
+	data, err := yaml.Marshal(settings)
+	if err == nil {
+		err = os.WriteFile(target.file, data, 0o644)
+	}
+	if err != nil {
+		slog.Error("viper: can't save config", "file", target.file, "err", err)
+		return err
+	}
+	rememberConfig()
+	return nil
+}
+
+// watchConfig starts watching the config file and its override files and applies all changes while ShuttleMidi is
+// running. Like viper.WatchConfig the directory is watched, so editors replacing the file are handled as well
+func watchConfig() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("config: can't watch config file", "err", err)
+		return
+	}
+	if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+		slog.Error("config: can't watch config file", "err", err)
+		watcher.Close()
+		return
+	}
+	watched := map[string]bool{filepath.Clean(configFile): true}
+	for _, v := range overrideFiles(configFile) {
+		watched[filepath.Clean(v)] = true
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if watched[filepath.Clean(event.Name)] && !event.Has(fsnotify.Chmod) && !requestEvent(reloadConfig) {
+					slog.Warn("config: event loop busy, changes not applied", "file", event.Name)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("config: watching config file failed", "err", err)
+			}
+		}
+	}()
+}
+
+// reloadConfig applies the content of the changed config files: the mapping is rebuilt, the MIDI port is reopened if
+// the control device changed, the tray menu is updated and the display refreshed. Invalid files are rejected and
+// the previous settings stay active. It runs within the event loop
+func reloadConfig() {
+	sources, err := readConfigSources(configFile)
+	if err != nil {
+		slog.Error("config: can't read config file", "err", err)
+		return
+	}
+	if hashSources(sources) == lastConfigHash { // written by ShuttleMidi itself or already handled
+		return
+	}
+	lastConfigHash = hashSources(sources)
+
+	candidate, err := newSettings(sources)
+	if err != nil {
+		slog.Error("config: invalid config file, changes ignored", "err", err)
+		return
+	}
+	if errs := validateConfig(candidate, sources); len(errs) > 0 {
+		logConfigErrors(errs)
+		slog.Error("config: invalid settings, changes ignored", "problems", len(errs))
+		return
+	}
+
+	previousDevice := profileMidiDevice()
+	previousChannel := activeProfile.channel
+	usedDisplay := viper.GetBool("useDisplay")
+
+	applySettings(sources)
+	if err := loadConfig(sources); err != nil {
+		slog.Error("config: invalid settings, changes ignored", "err", err)
+		applySettings(lastGoodConfig)
+		return
+	}
+	lastGoodConfig = sources
+	slog.Info("config: reloaded", "files", sourceFiles(sources))
+
+	if trayUpdate != nil {
+		trayUpdate()
+	}
+	if usedDisplay && !viper.GetBool("useDisplay") {
+		clearDisplay(currentDisplay()) // before its queue is replaced by updateDisplay
+	}
+	updateDisplayPort(midiPortNames)
+	updateDisplay()
+	switch {
+	case profileMidiDevice() != previousDevice || activeProfile.channel != previousChannel:
+		openControl(profileMidiDevice(), false) // refreshes the display as well
+	case viper.GetBool("useDisplay"):
+		refreshDisplay(currentDisplay())
+	}
+}
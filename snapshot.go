@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// stateSnapshot is a set of button states, CC values and volumes that can be applied at once
+type stateSnapshot struct {
+	name         string
+	buttons      map[int]bool       // button number -> state, only latching buttons are used
+	ccs          map[uint8]uint8    // additional midi CCs -> value
+	volumeOffset float64            // offset in dB applied to the main volume, e.g. for loudness matching
+	mainVolume   *float32           // main volume, nil leaves the main volume untouched
+	cueVolumes   map[string]float32 // cue name -> volume
+}
+
+// snapshotConfig is the representation of a stateSnapshot in the config file
+type snapshotConfig struct {
+	Name         string             `mapstructure:"name"`
+	Buttons      map[int]bool       `mapstructure:"buttons"`
+	CCs          map[int]int        `mapstructure:"ccs"`
+	VolumeOffset float64            `mapstructure:"volumeOffset"`
+	MainVolume   *float32           `mapstructure:"mainVolume"`
+	CueVolumes   map[string]float32 `mapstructure:"cueVolumes"`
+}
+
+var (
+	errSnapshotNotFound = errors.New("snapshot not found")
+	errSnapshotNoName   = errors.New("snapshot needs a name")
+
+	// volumeOffset is the main volume offset in dB of the currently applied snapshot
+	volumeOffset float64
+	// snapshots contains the named snapshots stored in the config key 'snapshots'
+	snapshots []*stateSnapshot
+	// snapshotCCs are the values of the snapshot CCs sent to the control MIDI device since it was opened
+	snapshotCCs = map[uint8]uint8{}
+)
+
+// newStateSnapshot converts the config representation into a stateSnapshot. Invalid CC numbers or values are ignored
+func newStateSnapshot(cfg snapshotConfig) *stateSnapshot {
+	snap := &stateSnapshot{name: cfg.Name, buttons: cfg.Buttons, ccs: map[uint8]uint8{}, volumeOffset: cfg.VolumeOffset,
+		mainVolume: cfg.MainVolume, cueVolumes: cfg.CueVolumes}
+	for cc, value := range cfg.CCs {
+		if cc >= 0 && cc <= 127 && value >= 0 && value <= 127 {
+			snap.ccs[uint8(cc)] = uint8(value)
+		}
+	}
+	return snap
+}
+
+// config returns the representation of the snapshot written to the config file
+func (snap *stateSnapshot) config() map[string]interface{} {
+	buttons := make(map[string]bool, len(snap.buttons))
+	for k, v := range snap.buttons {
+		buttons[strconv.Itoa(k)] = v
+	}
+	ccs := make(map[string]int, len(snap.ccs))
+	for k, v := range snap.ccs {
+		ccs[strconv.Itoa(int(k))] = int(v)
+	}
+	cfg := map[string]interface{}{
+		"name":         snap.name,
+		"buttons":      buttons,
+		"ccs":          ccs,
+		"volumeOffset": snap.volumeOffset,
+		"cueVolumes":   snap.cueVolumes,
+	}
+	if snap.mainVolume != nil {
+		cfg["mainVolume"] = *snap.mainVolume
+	}
+	return cfg
+}
+
+// applySnapshot switches all latching buttons to the state stored in the snapshot, sends its CCs and applies its
+// volumes. Buttons, CCs and volumes already in the requested state are left untouched
+func applySnapshot(midiController midiController, snap *stateSnapshot) {
+	if activeProfile.monitor {
+		applyMonitorButtons(midiController, snap)
+	} else {
+		for buttonNumber := range activeProfile.buttons {
+			if snapshotButtonChanged(snap, buttonNumber) {
+				doButton(midiController, buttonNumber, toggle)
+			}
+		}
+	}
+	for cc, value := range snap.ccs {
+		if sent, ok := snapshotCCs[cc]; !ok || sent != value {
+			midiController.sendCommand(cc, value, false)
+			snapshotCCs[cc] = value
+		}
+	}
+
+	previous := mainOutVolume()
+	volumeOffset = snap.volumeOffset
+	if snap.mainVolume != nil {
+		mainVolume = min(max(*snap.mainVolume, 0), 127)
+	}
+	if mainOutVolume() != previous {
+		sendMainVolume(midiController)
+	}
+
+	for i := range cues {
+		if volume, ok := snap.cueVolumes[cues[i].name]; ok && uint8(volume) != uint8(cues[i].volume) {
+			cues[i].volume = min(max(volume, 0), 127)
+			sendCueVolume(midiController, i)
+		}
+	}
+}
+
+// snapshotButtonChanged reports if the snapshot sets a latching button without an action to another state
+func snapshotButtonChanged(snap *stateSnapshot, buttonNumber int) bool {
+	state, ok := snap.buttons[buttonNumber]
+	if !ok || buttonNumber < 0 || buttonNumber >= len(activeProfile.buttons) {
+		return false
+	}
+	b := activeProfile.buttons[buttonNumber]
+	return b.latch && b.action == actionNone && b.state != state
+}
+
+// applyMonitorButtons switches the buttons of a monitor profile like pressing them, so the speaker/headphone
+// interlock of doMonitorButton applies. Headphones are switched off first and on last. While they stay on, the
+// speaker states are only stored, they are muted and restored when the headphones are switched off
+func applyMonitorButtons(midiController midiController, snap *stateSnapshot) {
+	if activeProfile.buttons[headPhoneButton].state && snapshotButtonChanged(snap, headPhoneButton) {
+		doMonitorButton(midiController, headPhoneButton)
+	}
+	for buttonNumber := range activeProfile.buttons {
+		if buttonNumber == headPhoneButton || !snapshotButtonChanged(snap, buttonNumber) {
+			continue
+		}
+		if activeProfile.buttons[headPhoneButton].state &&
+			(buttonNumber == LRbutton || buttonNumber == LFEbutton || buttonNumber == LsRsButton) {
+			activeProfile.buttons[buttonNumber].state = snap.buttons[buttonNumber]
+			continue
+		}
+		doMonitorButton(midiController, buttonNumber)
+	}
+	if !activeProfile.buttons[headPhoneButton].state && snapshotButtonChanged(snap, headPhoneButton) {
+		doMonitorButton(midiController, headPhoneButton)
+	}
+}
+
+// captureSnapshot returns a snapshot of the current state: all latching button states, the main and cue volumes
+func captureSnapshot(name string) *stateSnapshot {
+	volume := mainVolume
+	snap := &stateSnapshot{name: name, buttons: map[int]bool{}, ccs: map[uint8]uint8{}, volumeOffset: volumeOffset,
+		mainVolume: &volume, cueVolumes: map[string]float32{}}
+	for i := range activeProfile.buttons {
+		if activeProfile.buttons[i].latch && activeProfile.buttons[i].action == actionNone {
+			snap.buttons[i] = activeProfile.buttons[i].state
+		}
+	}
+	for i := range cues {
+		snap.cueVolumes[cues[i].name] = cues[i].volume
+	}
+	return snap
+}
+
+// readSnapshots reads the named snapshots from the config key 'snapshots'
+func readSnapshots() ([]*stateSnapshot, error) {
+	var cfg []snapshotConfig
+	if err := viper.UnmarshalKey("snapshots", &cfg); err != nil {
+		return nil, err
+	}
+	result := make([]*stateSnapshot, 0, len(cfg))
+	for _, v := range cfg {
+		result = append(result, newStateSnapshot(v))
+	}
+	return result, nil
+}
+
+// findSnapshot returns the snapshot with the given name or nil
+func findSnapshot(name string) *stateSnapshot {
+	for _, v := range snapshots {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// saveSnapshot captures the current state and stores it under the given name in the config file. An existing
+// snapshot with the same name is replaced
+func saveSnapshot(name string) error {
+	if name == "" {
+		return errSnapshotNoName
+	}
+	snap := captureSnapshot(name)
+	replaced := false
+	for i, v := range snapshots {
+		if v.name == name {
+			snapshots[i] = snap
+			replaced = true
+		}
+	}
+	if !replaced {
+		snapshots = append(snapshots, snap)
+	}
+
+	cfg := make([]map[string]interface{}, 0, len(snapshots))
+	for _, v := range snapshots {
+		cfg = append(cfg, v.config())
+	}
+	viper.Set("snapshots", cfg)
+	slog.Info("snapshot saved", "name", name)
+	return writeConfig("snapshots")
+}
+
+// recallSnapshot applies the named snapshot and refreshes the display. Only CCs whose state changes are sent.
+// Snapshots are recalled by a button, the tray menu or remotely by an OSC message (see handleOSC)
+func recallSnapshot(midiController midiController, name string) error {
+	snap := findSnapshot(name)
+	if snap == nil {
+		return errSnapshotNotFound
+	}
+	slog.Info("recalling snapshot", "name", name)
+	applySnapshot(midiController, snap)
+	refreshDisplay(currentDisplay())
+	return nil
+}
+
+// requestRecall asks the event loop to recall the named snapshot. It returns false if the event loop doesn't accept
+// the request (see requestEvent)
+func requestRecall(name string) bool {
+	return requestEvent(func() {
+		if err := recallSnapshot(mControl, name); err != nil {
+			slog.Error("can't recall snapshot", "name", name, "err", err)
+		}
+	})
+}
+
+// snapshotButton returns the button definition used for a button mapped to the snapshot action
+func snapshotButton(name string) button {
+	return button{
+		latch:  false,
+		arg:    name,
+		action: actionSnapshot,
+	}
+}
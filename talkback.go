@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/spf13/viper"
+)
+
+// talkbackButton returns the button definition used for a button mapped to the talkback action
+func talkbackButton() button {
+	return button{
+		state:      false,
+		cc:         uint8(viper.GetInt("talkbackCC")),
+		note:       viper.GetBool("talkbackNote"),
+		latch:      viper.GetBool("talkbackLatch"),
+		msgOn:      " -TALK-",
+		msgOff:     "", // the previous cell content is restored by displayCell
+		LCDchannel: 8,
+		LCDrow:     lowerRow,
+		action:     actionTalkback,
+	}
+}
+
+// talkbackActive reports if any talkback button is currently active
+func talkbackActive() bool {
+	for i := range activeProfile.buttons {
+		if activeProfile.buttons[i].action == actionTalkback && activeProfile.buttons[i].state {
+			return true
+		}
+	}
+	return false
+}
+
+// doTalkback switches talkback on while the button is held (or toggles it for a latching button). While active the
+// talkback CC is sent, the main volume is dimmed by talkbackDimLevel and all cues are optionally set to
+// talkbackCueLevel. Switching talkback off reverts the volumes and the display.
+func doTalkback(midiController midiController, buttonNumber int, pressed bool) {
+	active := pressed
+	if activeProfile.buttons[buttonNumber].latch {
+		if !pressed {
+			return
+		}
+		active = !activeProfile.buttons[buttonNumber].state
+	}
+	if active == activeProfile.buttons[buttonNumber].state {
+		return
+	}
+	activeProfile.buttons[buttonNumber].state = active
+
+	if active {
+		doButton(midiController, buttonNumber, on)
+	} else {
+		doButton(midiController, buttonNumber, off)
+		if viper.GetBool("useDisplay") {
+			displayCell(activeProfile.buttons[buttonNumber].LCDchannel, activeProfile.buttons[buttonNumber].LCDrow)
+		}
+	}
+	sendMainVolume(midiController)
+
+	if cueLevel := viper.GetInt("talkbackCueLevel"); cueLevel >= 0 && cueLevel <= 127 {
+		for i := range cues {
+			if talkbackActive() {
+				sendCueValue(midiController, i, uint8(cueLevel))
+			} else {
+				sendCueValue(midiController, i, uint8(cues[i].volume))
+			}
+		}
+	}
+}
+
+// displayCell shows the text of the last active latching button located at the given LCD cell, or clears the cell
+// if no button there is active
+func displayCell(channel uint8, row uint8) {
+	text := "       "
+	for i := range activeProfile.buttons {
+		if activeProfile.buttons[i].latch && activeProfile.buttons[i].state && activeProfile.buttons[i].LCDchannel == channel && activeProfile.buttons[i].LCDrow == row && activeProfile.buttons[i].msgOn != "" {
+			text = activeProfile.buttons[i].msgOn
+		}
+	}
+	showCell(channel, row, text)
+}
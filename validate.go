@@ -0,0 +1,597 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/awitez/shuttleMidi/devices"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// sysexHeader matches sysex bytes given in hex like "00 00 66 14"
+var sysexHeader = regexp.MustCompile(`^\s*([0-9A-Fa-f]{2}\s*)*$`)
+
+// configError describes a single problem of the settings, located by field path and line of the config file
+type configError struct {
+	field string // e.g. profiles[1].buttons[3].cc
+	file  string // config file containing the value, empty if the value isn't part of a file (e.g. a default)
+	line  int
+	msg   string
+}
+
+func (e configError) Error() string {
+	if e.file != "" {
+		return fmt.Sprintf("%s:%d: %s: %s", e.file, e.line, e.field, e.msg)
+	}
+	return fmt.Sprintf("%s: %s", e.field, e.msg)
+}
+
+// configValidator collects the configErrors of a settings instance
+type configValidator struct {
+	files  []string     // config files in the order they are merged
+	roots  []*yaml.Node // parsed config files, used to find line numbers
+	errors []configError
+}
+
+// fieldPath is the path of a settings field, consisting of map keys (string) and list indexes (int)
+type fieldPath []interface{}
+
+func (p fieldPath) String() string {
+	var sb strings.Builder
+	for _, v := range p {
+		switch k := v.(type) {
+		case int:
+			fmt.Fprintf(&sb, "[%d]", k)
+		default:
+			if sb.Len() > 0 {
+				sb.WriteString(".")
+			}
+			fmt.Fprint(&sb, k)
+		}
+	}
+	return sb.String()
+}
+
+// add returns a new path extended by the given elements
+func (p fieldPath) add(elements ...interface{}) fieldPath {
+	return append(append(fieldPath{}, p...), elements...)
+}
+
+// line returns the file and line number of the deepest node of the path. The last file defining the top level key
+// of the path is used, as its value overrides the ones of the previous files
+func (cv *configValidator) line(path fieldPath) (string, int) {
+	for i := len(cv.roots) - 1; i >= 0; i-- {
+		if line := nodeLine(cv.roots[i], path); line > 0 {
+			return cv.files[i], line
+		}
+	}
+	return "", 0
+}
+
+// nodeLine returns the line number of the deepest node of the path found in the parsed config file, 0 if the top
+// level key isn't part of it
+func nodeLine(root *yaml.Node, path fieldPath) int {
+	if root == nil || len(root.Content) == 0 {
+		return 0
+	}
+	node := root.Content[0] // document -> top level mapping
+	line := 0
+	for _, v := range path {
+		var next *yaml.Node
+		switch k := v.(type) {
+		case int:
+			if node.Kind == yaml.SequenceNode && k < len(node.Content) {
+				next = node.Content[k]
+			}
+		default:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if strings.EqualFold(node.Content[i].Value, fmt.Sprint(k)) {
+						line = node.Content[i].Line
+						next = node.Content[i+1]
+					}
+				}
+			}
+		}
+		if next == nil {
+			return line
+		}
+		node = next
+		line = node.Line
+	}
+	return line
+}
+
+// fail records a problem of the field at path
+func (cv *configValidator) fail(path fieldPath, format string, a ...interface{}) {
+	file, line := cv.line(path)
+	cv.errors = append(cv.errors, configError{field: path.String(), file: file, line: line, msg: fmt.Sprintf(format, a...)})
+}
+
+// normalize converts typed slices and maps (e.g. from configDefaults) into []interface{} and
+// map[string]interface{} with lower case keys, the way viper returns values read from the config file
+func normalize(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice:
+		l := make([]interface{}, rv.Len())
+		for i := range l {
+			l[i] = normalize(rv.Index(i).Interface())
+		}
+		return l
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			m[strings.ToLower(fmt.Sprint(iter.Key().Interface()))] = normalize(iter.Value().Interface())
+		}
+		return m
+	}
+	return value
+}
+
+// toInt converts a settings value to int. It reports false for non integral values
+func toInt(value interface{}) (int, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return int(rv.Float()), rv.Float() == math.Trunc(rv.Float())
+	case reflect.String:
+		i, err := strconv.Atoi(rv.String())
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// checkRange checks that the field is an integer in the range min..max and returns it
+func (cv *configValidator) checkRange(path fieldPath, value interface{}, min, max int, what string) (int, bool) {
+	if value == nil {
+		return 0, false
+	}
+	i, ok := toInt(value)
+	if !ok {
+		cv.fail(path, "%s must be an integer, got %v", what, value)
+		return 0, false
+	}
+	if i < min || i > max {
+		cv.fail(path, "%s %d out of range %d-%d", what, i, min, max)
+		return i, false
+	}
+	return i, true
+}
+
+// checkNumber checks that the field is a number
+func (cv *configValidator) checkNumber(path fieldPath, value interface{}) {
+	if value == nil {
+		return
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+	default:
+		cv.fail(path, "must be a number, got %v", value)
+	}
+}
+
+// roundVolume truncates fractional volumes (the dial changes volumes in fractional steps) for checkRange
+func roundVolume(value interface{}) interface{} {
+	if f, ok := value.(float64); ok {
+		return math.Trunc(f)
+	}
+	return value
+}
+
+// checkText checks that the field is a text fitting into a display cell
+func (cv *configValidator) checkText(path fieldPath, value interface{}) {
+	if value == nil {
+		return
+	}
+	text, ok := value.(string)
+	if !ok {
+		cv.fail(path, "must be a text, got %v", value)
+		return
+	}
+	if len(text) > 7 {
+		cv.fail(path, "text %q is longer than 7 characters", text)
+	}
+}
+
+// checkPortSpec checks a MIDI port selection like "exact:X-Touch INT" or "regex:^X-Touch"
+func (cv *configValidator) checkPortSpec(path fieldPath, value interface{}) {
+	if spec, ok := value.(string); ok {
+		if _, _, err := parsePortSpec(spec); err != nil {
+			cv.fail(path, "%v", err)
+		}
+	}
+}
+
+// checkColor checks that the field is one of the color names of the LCD strips
+func (cv *configValidator) checkColor(path fieldPath, value interface{}) {
+	if value == nil || value == "" {
+		return
+	}
+	name, _ := value.(string)
+	if _, ok := colorNames[name]; !ok {
+		cv.fail(path, "unknown color %v, must be one of black, red, green, yellow, blue, magenta, cyan, white", value)
+	}
+}
+
+// checkRingMode checks that the field is one of the V-Pot ring modes
+func (cv *configValidator) checkRingMode(path fieldPath, value interface{}) {
+	if value == nil || value == "" {
+		return
+	}
+	name, _ := value.(string)
+	if _, ok := ringModes[name]; !ok {
+		cv.fail(path, "unknown ring mode %v, must be 'dot', 'fill' or 'spread'", value)
+	}
+}
+
+// checkAction checks a button action like "talkback" or "snapshot:<name>"
+func (cv *configValidator) checkAction(path fieldPath, value interface{}, snapshotNames map[string]bool) {
+	action, _ := value.(string)
+	name, arg, _ := strings.Cut(action, ":")
+	if _, ok := actionNames[name]; !ok {
+		cv.fail(path, "unknown action %q", action)
+		return
+	}
+	if actionNames[name] == actionSnapshot && !snapshotNames[arg] {
+		cv.fail(path, "action %q refers to unknown snapshot %q", action, arg)
+	}
+}
+
+// list returns the value as list, reporting a problem if it is no list
+func (cv *configValidator) list(path fieldPath, value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+	l, ok := normalize(value).([]interface{})
+	if !ok {
+		cv.fail(path, "must be a list")
+	}
+	return l
+}
+
+// dict returns the value as map, reporting a problem if it is no map
+func (cv *configValidator) dict(path fieldPath, value interface{}) map[string]interface{} {
+	if value == nil {
+		return nil
+	}
+	m, ok := normalize(value).(map[string]interface{})
+	if !ok {
+		cv.fail(path, "must be a map")
+	}
+	return m
+}
+
+// sortedKeys returns the keys of m in a stable order, numbers in numeric order before other keys
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		na, errA := strconv.Atoi(a)
+		nb, errB := strconv.Atoi(b)
+		switch {
+		case errA == nil && errB == nil:
+			return cmp.Compare(na, nb)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+// midiNumber is a CC or note number sent by a profile
+type midiNumber struct {
+	note   bool
+	number int
+}
+
+// String returns the kind and number like "CC number 20"
+func (n midiNumber) String() string {
+	if n.note {
+		return fmt.Sprintf("note number %d", n.number)
+	}
+	return fmt.Sprintf("CC number %d", n.number)
+}
+
+// ccUsage tracks the CC and note numbers used in a profile to find duplicates, a note doesn't clash with a CC
+type ccUsage map[midiNumber]fieldPath
+
+// useCC checks the CC (or note) number value and reports it if it is already used
+func (cv *configValidator) useCC(used ccUsage, path fieldPath, value interface{}, note bool) {
+	kind := "CC number"
+	if note {
+		kind = "note number"
+	}
+	number, ok := cv.checkRange(path, value, 0, 127, kind)
+	if !ok {
+		return
+	}
+	n := midiNumber{note: note, number: number}
+	if previous, found := used[n]; found {
+		cv.fail(path, "%s is already used by %s", n, previous)
+		return
+	}
+	used[n] = path
+}
+
+// checkStateSnapshot checks the buttons, CCs and volumes of a snapshot or A/B state
+func (cv *configValidator) checkStateSnapshot(path fieldPath, value interface{}) {
+	snap := cv.dict(path, value)
+	for _, k := range sortedKeys(cv.dict(path.add("buttons"), snap["buttons"])) {
+		cv.checkRange(path.add("buttons", k), k, 0, 14, "button number")
+	}
+	ccs := cv.dict(path.add("ccs"), snap["ccs"])
+	for _, k := range sortedKeys(ccs) {
+		cv.checkRange(path.add("ccs", k), k, 0, 127, "CC number")
+		cv.checkRange(path.add("ccs", k), ccs[k], 0, 127, "CC value")
+	}
+	cv.checkNumber(path.add("volumeOffset"), snap["volumeoffset"])
+	cv.checkRange(path.add("mainVolume"), roundVolume(snap["mainvolume"]), 0, 127, "volume")
+}
+
+// validateConfig checks the settings of v and returns all problems found. sources are the config files merged into
+// v, used to report file names and line numbers
+func validateConfig(v *viper.Viper, sources []configSource) []configError {
+	cv := &configValidator{}
+	for _, source := range sources {
+		root := &yaml.Node{}
+		if err := yaml.Unmarshal(source.data, root); err != nil {
+			root = nil
+		}
+		cv.files = append(cv.files, source.file)
+		cv.roots = append(cv.roots, root)
+	}
+
+	for _, k := range []string{"controlMidiDevice", "displayMidiDevice", "oscTarget", "oscListen"} {
+		if _, ok := v.Get(k).(string); !ok && v.Get(k) != nil {
+			cv.fail(fieldPath{k}, "must be a text, got %v", v.Get(k))
+		}
+	}
+	cv.checkPortSpec(fieldPath{"controlMidiDevice"}, v.Get("controlMidiDevice"))
+	cv.checkPortSpec(fieldPath{"displayMidiDevice"}, v.Get("displayMidiDevice"))
+	displayTypes := []string{devices.DisplayXTouch, devices.DisplayMCU, devices.DisplayMCUCompatible, devices.DisplayTUI,
+		devices.DisplayNone}
+	if kind := v.GetString("displayType"); !slices.Contains(displayTypes, kind) {
+		cv.fail(fieldPath{"displayType"}, "unknown display type %q, must be one of %s", kind, strings.Join(displayTypes, ", "))
+	}
+	if header := v.GetString("displaySysexHeader"); !sysexHeader.MatchString(header) {
+		cv.fail(fieldPath{"displaySysexHeader"}, "must be hex bytes like '00 00 66 14', got %q", header)
+	}
+	cv.checkRange(fieldPath{"displayQueueSize"}, v.Get("displayQueueSize"), 1, 100000, "queue size")
+	cv.checkRange(fieldPath{"displayRate"}, v.Get("displayRate"), 0, 100000, "message rate")
+	for i, page := range cv.list(fieldPath{"displayPages"}, v.Get("displayPages")) {
+		if name, _ := page.(string); !slices.Contains(pageNames, name) {
+			cv.fail(fieldPath{"displayPages", i}, "unknown page %v, must be one of %s", page, strings.Join(pageNames, ", "))
+		}
+	}
+	cv.checkColor(fieldPath{"stripColor"}, v.Get("stripColor"))
+	cv.checkRingMode(fieldPath{"mainRing"}, v.Get("mainRing"))
+	if show := v.GetString("timecodeDisplay"); !slices.Contains([]string{"", "volume", "profile"}, show) {
+		cv.fail(fieldPath{"timecodeDisplay"}, "must be 'volume', 'profile' or empty, got %q", show)
+	}
+	if show := v.GetString("assignmentDisplay"); !slices.Contains([]string{"", "speakers", "profile"}, show) {
+		cv.fail(fieldPath{"assignmentDisplay"}, "must be 'speakers', 'profile' or empty, got %q", show)
+	}
+	cv.checkRange(fieldPath{"configVersion"}, v.Get("configVersion"), 1, currentConfigVersion, "config version")
+	cv.checkRange(fieldPath{"talkbackCC"}, v.Get("talkbackCC"), 0, 127, "CC number")
+	cv.checkRange(fieldPath{"talkbackCueLevel"}, v.Get("talkbackCueLevel"), -1, 127, "volume")
+	cv.checkRange(fieldPath{"blinkRate"}, v.Get("blinkRate"), 0, 10000, "blink rate")
+	cv.checkNumber(fieldPath{"dimLevel"}, v.Get("dimLevel"))
+	cv.checkNumber(fieldPath{"talkbackDimLevel"}, v.Get("talkbackDimLevel"))
+
+	// snapshots first, actions refer to them
+	snapshotNames := map[string]bool{}
+	for i, s := range cv.list(fieldPath{"snapshots"}, v.Get("snapshots")) {
+		path := fieldPath{"snapshots", i}
+		name, _ := cv.dict(path, s)["name"].(string)
+		if name == "" {
+			cv.fail(path.add("name"), "snapshot needs a name")
+		} else if snapshotNames[name] {
+			cv.fail(path.add("name"), "duplicate snapshot name %q", name)
+		}
+		snapshotNames[name] = true
+		cv.checkStateSnapshot(path, s)
+	}
+	ab := cv.dict(fieldPath{"abCompare"}, v.Get("abCompare"))
+	cv.checkStateSnapshot(fieldPath{"abCompare", "a"}, ab["a"])
+	cv.checkStateSnapshot(fieldPath{"abCompare", "b"}, ab["b"])
+
+	buttonActions := cv.dict(fieldPath{"buttonActions"}, v.Get("buttonActions"))
+	for _, k := range sortedKeys(buttonActions) {
+		cv.checkRange(fieldPath{"buttonActions", k}, k, 0, 14, "button number")
+		cv.checkAction(fieldPath{"buttonActions", k}, buttonActions[k], snapshotNames)
+	}
+	for i, b := range cv.list(fieldPath{"profileChord"}, v.Get("profileChord")) {
+		cv.checkRange(fieldPath{"profileChord", i}, b, 0, 14, "button number")
+	}
+
+	// cues
+	cueCCs := map[int]fieldPath{}
+	cueNames := map[string]bool{}
+	for i, c := range cv.list(fieldPath{"cues"}, v.Get("cues")) {
+		path := fieldPath{"cues", i}
+		cfg := cv.dict(path, c)
+		name, _ := cfg["name"].(string)
+		if name == "" {
+			cv.fail(path.add("name"), "cue needs a name")
+		} else if cueNames[name] {
+			cv.fail(path.add("name"), "duplicate cue name %q", name)
+		}
+		cueNames[name] = true
+		if osc, _ := cfg["osc"].(string); osc == "" {
+			if cc, ok := cv.checkRange(path.add("cc"), cfg["cc"], 0, 127, "CC number"); ok {
+				if previous, found := cueCCs[cc]; found {
+					cv.fail(path.add("cc"), "CC number %d is already used by %s", cc, previous)
+				} else if cc == mainVolumeCC {
+					cv.fail(path.add("cc"), "CC number %d is used for the main volume", cc)
+				}
+				cueCCs[cc] = path.add("cc")
+			}
+		}
+		cv.checkRange(path.add("volume"), roundVolume(cfg["volume"]), 0, 127, "volume")
+		cv.checkRange(path.add("lcdChannel"), cfg["lcdchannel"], 0, 8, "LCD channel")
+		cv.checkRingMode(path.add("ring"), cfg["ring"])
+	}
+
+	// profiles
+	talkbackCC := v.GetInt("talkbackCC")
+	profileNames := map[string]bool{}
+	profileList := cv.list(fieldPath{"profiles"}, v.Get("profiles"))
+	if len(profileList) == 0 {
+		profileNames["Monitor"] = true // built-in profile
+	}
+	for i, p := range profileList {
+		path := fieldPath{"profiles", i}
+		cfg := cv.dict(path, p)
+		name, _ := cfg["name"].(string)
+		if name == "" {
+			cv.fail(path.add("name"), "profile needs a name")
+		} else if profileNames[name] {
+			cv.fail(path.add("name"), "duplicate profile name %q", name)
+		}
+		profileNames[name] = true
+		cv.checkRange(path.add("channel"), cfg["channel"], 0, 15, "MIDI channel")
+		cv.checkPortSpec(path.add("midiDevice"), cfg["mididevice"])
+
+		used := ccUsage{}
+		monitor, _ := cfg["monitor"].(bool)
+		if monitor {
+			used[midiNumber{number: mainVolumeCC}] = fieldPath{"mainVolumeCC"}
+			for cc, cuePath := range cueCCs {
+				used[midiNumber{number: cc}] = cuePath
+			}
+		} else {
+			cv.useCC(used, path.add("dialCC"), cfg["dialcc"], false)
+		}
+		for j, cc := range cv.list(path.add("wheelCCs"), cfg["wheelccs"]) {
+			cv.useCC(used, path.add("wheelCCs", j), cc, false)
+		}
+		talkback := false // the talkback CC is sent once for all talkback buttons of the profile
+
+		buttons := cv.list(path.add("buttons"), cfg["buttons"])
+		if len(buttons) > 15 {
+			cv.fail(path.add("buttons"), "%d buttons defined, the ShuttlePRO has 15", len(buttons))
+		}
+		for j, b := range buttons {
+			bPath := path.add("buttons", j)
+			button := cv.dict(bPath, b)
+			cv.checkColor(bPath.add("colorOn"), button["coloron"])
+			cv.checkColor(bPath.add("colorOff"), button["coloroff"])
+			if blink := button["blink"]; blink != nil && blink != "" && !slices.Contains(blinkModes, fmt.Sprint(blink)) {
+				cv.fail(bPath.add("blink"), "must be 'text', 'color' or 'both', got %v", blink)
+			}
+			cv.checkRange(bPath.add("led"), button["led"], 0, 127, "note number")
+			for _, k := range []string{"ledOn", "ledOff"} {
+				if mode := button[strings.ToLower(k)]; mode != nil && mode != "" {
+					if _, ok := ledModes[fmt.Sprint(mode)]; !ok {
+						cv.fail(bPath.add(k), "must be 'off', 'on' or 'blink', got %v", mode)
+					}
+				}
+			}
+			if button["action"] != nil && button["action"] != "" {
+				cv.checkAction(bPath.add("action"), button["action"], snapshotNames)
+				if button["action"] == "talkback" && !talkback && talkbackCC >= 0 && talkbackCC <= 127 {
+					talkback = true
+					n := midiNumber{note: v.GetBool("talkbackNote"), number: talkbackCC}
+					if previous, found := used[n]; found {
+						cv.fail(bPath.add("action"), "talkback %s is already used by %s", n, previous)
+					} else {
+						used[n] = fieldPath{"talkbackCC"}
+					}
+				}
+				continue
+			}
+			note, _ := button["note"].(bool)
+			cv.useCC(used, bPath.add("cc"), button["cc"], note)
+			cv.checkRange(bPath.add("lcdChannel"), button["lcdchannel"], 0, 8, "LCD channel")
+			cv.checkText(bPath.add("msgOn"), button["msgon"])
+			cv.checkText(bPath.add("msgOff"), button["msgoff"])
+			if row, _ := button["lcdrow"].(string); row != "" && row != "upper" && row != "lower" {
+				cv.fail(bPath.add("lcdRow"), "must be 'upper' or 'lower', got %q", row)
+			}
+		}
+	}
+
+	if name := v.GetString("activeProfile"); !profileNames[name] {
+		cv.fail(fieldPath{"activeProfile"}, "unknown profile %q", name)
+	}
+	for i, r := range cv.list(fieldPath{"focusRules"}, v.Get("focusRules")) {
+		path := fieldPath{"focusRules", i}
+		rule := cv.dict(path, r)
+		match, _ := rule["match"].(string)
+		if _, err := regexp.Compile(match); err != nil {
+			cv.fail(path.add("match"), "invalid regular expression: %v", err)
+		}
+		if name, _ := rule["profile"].(string); !profileNames[name] {
+			cv.fail(path.add("profile"), "unknown profile %q", name)
+		}
+	}
+	return cv.errors
+}
+
+// logConfigErrors logs every problem found by validateConfig
+func logConfigErrors(errs []configError) {
+	for _, v := range errs {
+		slog.Error("config: invalid setting", "file", v.file, "line", v.line, "field", v.field, "problem", v.msg)
+	}
+}
+
+// joinConfigErrors combines the problems found by validateConfig into a single error
+func joinConfigErrors(errs []configError) error {
+	result := make([]error, 0, len(errs))
+	for _, v := range errs {
+		result = append(result, v)
+	}
+	return errors.Join(result...)
+}
+
+// validateCommand implements 'shuttlemidi config validate [file]'. It checks the given config file (default: the
+// one used by ShuttleMidi) merged with its override files, prints every problem as file:line: field: message and
+// returns the exit code
+func validateCommand(args []string) int {
+	file := resolveConfigFile()
+	if len(args) > 0 {
+		file = args[0]
+	}
+	sources, err := readConfigSources(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	settings, err := newSettings(sources)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	errs := validateConfig(settings, sources)
+	for _, v := range errs {
+		fmt.Fprintln(os.Stderr, v)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Printf("%s: ok\n", strings.Join(sourceFiles(sources), ", "))
+	return 0
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// validateSources returns the problems validateConfig finds in the config files, given by name and content
+func validateSources(t *testing.T, files ...string) []string {
+	t.Helper()
+	sources := []configSource{}
+	for i := 0; i+1 < len(files); i += 2 {
+		sources = append(sources, configSource{file: files[i], data: []byte(files[i+1])})
+	}
+	v, err := newSettings(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := []string{}
+	for _, e := range validateConfig(v, sources) {
+		result = append(result, e.Error())
+	}
+	return result
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string // file name and content pairs
+		want  []string
+	}{
+		{"defaults", nil, []string{}},
+		{"display settings", []string{"config.yaml", `
+displayType: lcd
+displaySysexHeader: 00 0x
+displayMidiDevice: "regex:(["
+`}, []string{
+			`config.yaml:4: displayMidiDevice: invalid MIDI port selection: regex:([: error parsing regexp: missing ` +
+				"closing ]: `[`",
+			`config.yaml:2: displayType: unknown display type "lcd", must be one of xtouch, mcu, mcuCompatible, tui, none`,
+			`config.yaml:3: displaySysexHeader: must be hex bytes like '00 00 66 14', got "00 0x"`,
+		}},
+		{"cues", []string{"config.yaml", `
+cues:
+  - name: Phones
+    cc: 7
+  - name: Phones
+    cc: 20
+    volume: 200
+  - name: Cue 3
+    cc: 20
+    ring: bar
+`}, []string{
+			`config.yaml:4: cues[0].cc: CC number 7 is used for the main volume`,
+			`config.yaml:5: cues[1].name: duplicate cue name "Phones"`,
+			`config.yaml:7: cues[1].volume: volume 200 out of range 0-127`,
+			`config.yaml:9: cues[2].cc: CC number 20 is already used by cues[1].cc`,
+			`config.yaml:10: cues[2].ring: unknown ring mode bar, must be 'dot', 'fill' or 'spread'`,
+		}},
+		{"profiles", []string{"config.yaml", `
+activeProfile: Mixer
+profiles:
+  - name: Reaper
+    channel: 16
+    wheelCCs: [20, 21]
+    buttons:
+      - cc: 20
+        msgOn: too long text
+      - action: snapshot:Missing
+focusRules:
+  - match: "(["
+    profile: Reaper
+  - match: firefox
+    profile: Browser
+`}, []string{
+			`config.yaml:5: profiles[0].channel: MIDI channel 16 out of range 0-15`,
+			`config.yaml:8: profiles[0].buttons[0].cc: CC number 20 is already used by profiles[0].wheelCCs[0]`,
+			`config.yaml:9: profiles[0].buttons[0].msgOn: text "too long text" is longer than 7 characters`,
+			`config.yaml:10: profiles[0].buttons[1].action: action "snapshot:Missing" refers to unknown snapshot "Missing"`,
+			`config.yaml:2: activeProfile: unknown profile "Mixer"`,
+			"config.yaml:12: focusRules[0].match: invalid regular expression: error parsing regexp: missing closing ]: `[`",
+			`config.yaml:15: focusRules[1].profile: unknown profile "Browser"`,
+		}},
+		{"stable order of maps", []string{"config.yaml", `
+snapshots:
+  - name: Mix
+    buttons: {"20": true, "3": true, "15": true, "x": true}
+    ccs: {"200": 1, "9": 300}
+buttonActions: {"16": talkback, "2": unknown}
+`}, []string{
+			`config.yaml:4: snapshots[0].buttons.15: button number 15 out of range 0-14`,
+			`config.yaml:4: snapshots[0].buttons.20: button number 20 out of range 0-14`,
+			`config.yaml:4: snapshots[0].buttons.x: button number must be an integer, got x`,
+			`config.yaml:5: snapshots[0].ccs.9: CC value 300 out of range 0-127`,
+			`config.yaml:5: snapshots[0].ccs.200: CC number 200 out of range 0-127`,
+			`config.yaml:6: buttonActions.2: unknown action "unknown"`,
+			`config.yaml:6: buttonActions.16: button number 16 out of range 0-14`,
+		}},
+		{"notes and CCs", []string{"config.yaml", `
+talkbackCC: 30
+activeProfile: Reaper
+profiles:
+  - name: Reaper
+    wheelCCs: [20, 30]
+    buttons:
+      - cc: 20
+        note: true
+      - cc: 20
+        note: true
+      - action: talkback
+      - action: talkback
+  - name: Notes
+    wheelCCs: [20]
+    buttons:
+      - cc: 30
+        note: true
+      - action: talkback
+`}, []string{
+			`config.yaml:10: profiles[0].buttons[1].cc: note number 20 is already used by profiles[0].buttons[0].cc`,
+			`config.yaml:12: profiles[0].buttons[2].action: talkback CC number 30 is already used by ` +
+				`profiles[0].wheelCCs[1]`,
+		}},
+		{"override file", []string{"config.yaml", "blinkRate: 400\ntalkbackCC: 20\n", "config.local.yaml",
+			"\nblinkRate: 20000\n"}, []string{
+			`config.local.yaml:2: blinkRate: blink rate 20000 out of range 0-10000`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateSources(t, tt.files...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateConfig() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigFixtures(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "config.v2*.yaml"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatal("no fixtures", err)
+	}
+	for _, v := range fixtures {
+		data, err := os.ReadFile(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := validateSources(t, v, string(data)); len(errs) > 0 {
+			t.Errorf("%s: %q", v, errs)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// volumeToDB returns the dB level of a main volume value as listed in mainVolTable. Value 0 returns -Inf
+func volumeToDB(value uint8) float64 {
+	db, err := strconv.ParseFloat(strings.TrimSpace(mainVolTable[value&127]), 64)
+	if err != nil { // "-oo"
+		return math.Inf(-1)
+	}
+	return db
+}
+
+// dbToVolume returns the main volume value whose dB level is closest to the given level
+func dbToVolume(db float64) uint8 {
+	var result uint8
+	minDiff := math.Inf(1)
+	for i := range mainVolTable {
+		if diff := math.Abs(volumeToDB(uint8(i)) - db); diff < minDiff {
+			minDiff = diff
+			result = uint8(i)
+		}
+	}
+	return result
+}
+
+// attenuate returns the main volume value lowered by the given amount of dB, following the volume curve of mainVolTable
+func attenuate(value uint8, db float64) uint8 {
+	if value == 0 {
+		return 0
+	}
+	return dbToVolume(volumeToDB(value) - math.Abs(db))
+}
+
+// internalDim reports if ShuttleMidi dims the main volume itself instead of leaving it to the DAW
+func internalDim() bool {
+	return viper.GetBool("useInternalDim")
+}
+
+// dimActive reports if ShuttleMidi currently dims the main volume itself
+func dimActive() bool {
+	return internalDim() && activeProfile.monitor && activeProfile.buttons[dimButton].action == actionNone &&
+		activeProfile.buttons[dimButton].state
+}
+
+// mainOutVolume returns the main volume value that is sent out, i.e. shifted by the volume offset of the active
+// A/B state and attenuated by dimLevel while dim is active and by talkbackDimLevel while talkback is active. If both
+// are active the stronger attenuation is used
+func mainOutVolume() uint8 {
+	base := uint8(mainVolume)
+	if volumeOffset != 0 && base > 0 {
+		base = max(1, dbToVolume(volumeToDB(base)+volumeOffset))
+	}
+	volume := base
+	if dimActive() {
+		volume = min(volume, attenuate(base, viper.GetFloat64("dimLevel")))
+	}
+	if talkbackActive() {
+		volume = min(volume, attenuate(base, viper.GetFloat64("talkbackDimLevel")))
+	}
+	return volume
+}
+
+// sendMainVolume transmits the main volume to the MIDI device and shows its dB value on the display. Only monitor
+// profiles control the main volume
+func sendMainVolume(midiController midiController) {
+	if !activeProfile.monitor {
+		return
+	}
+	volume := mainOutVolume()
+	if viper.GetBool("useDisplay") {
+		showCell(activeProfile.buttons[LRbutton].LCDchannel, lowerRow, mainVolTable[volume])
+		showVolumeRing(activeProfile.buttons[LRbutton].LCDchannel, viper.GetString("mainRing"), volume)
+		showSegmentDisplay()
+	}
+	midiController.sendCommand(mainVolumeCC, volume, false)
+}